@@ -36,4 +36,7 @@ docker-compose up -d
 # Wait a moment for Postgres to initialize before reporting success
 Start-Sleep -Seconds 5
 
+Write-Host "🗄️  Applying database migrations..."
+go run ./cmd/kafkasync migrate up
+
 Write-Host "✅ System is fresh and ready for a demo!"
\ No newline at end of file
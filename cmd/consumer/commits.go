@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// offsetTracker decides which offsets are safe to commit. A partition's
+// offset only advances past messages whose jobs have all finished, so a
+// slow job holds back commits for everything fetched after it.
+type offsetTracker struct {
+	mu         sync.Mutex
+	partitions map[int]*partitionOffsets
+
+	// commitMu keeps CommitMessages calls in the order Done handed them
+	// out, so concurrent workers can never move an offset backwards.
+	commitMu sync.Mutex
+}
+
+type partitionOffsets struct {
+	pending   []int64       // fetched offsets not yet committable, in fetch order
+	done      map[int64]int // finished copies of each offset, for redeliveries
+	committed int64         // highest offset Done has handed out, -1 for none
+}
+
+func newOffsetTracker() *offsetTracker {
+	return &offsetTracker{partitions: make(map[int]*partitionOffsets)}
+}
+
+// Add registers a fetched message. It must be called in fetch order.
+func (t *offsetTracker) Add(msg kafka.Message) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	p, ok := t.partitions[msg.Partition]
+	if !ok {
+		p = &partitionOffsets{done: make(map[int64]int), committed: -1}
+		t.partitions[msg.Partition] = p
+	}
+	p.pending = append(p.pending, msg.Offset)
+}
+
+// Done marks msg as finished and returns the highest message in its
+// partition that can now be committed, if any. A redelivered offset that
+// was already committed past is never handed out again.
+func (t *offsetTracker) Done(msg kafka.Message) (kafka.Message, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	p, ok := t.partitions[msg.Partition]
+	if !ok {
+		return kafka.Message{}, false
+	}
+	p.done[msg.Offset]++
+
+	last := int64(-1)
+	for len(p.pending) > 0 && p.done[p.pending[0]] > 0 {
+		offset := p.pending[0]
+		if p.done[offset]--; p.done[offset] == 0 {
+			delete(p.done, offset)
+		}
+		p.pending = p.pending[1:]
+		last = max(last, offset)
+	}
+	if last <= p.committed {
+		return kafka.Message{}, false
+	}
+	p.committed = last
+	// Every message of a partition carries the same topic, and committing
+	// only needs the coordinates.
+	return kafka.Message{Topic: msg.Topic, Partition: msg.Partition, Offset: last}, true
+}
+
+// commit marks msg finished and commits whatever the tracker allows.
+func commit(reader *kafka.Reader, tracker *offsetTracker, msg kafka.Message) {
+	tracker.commitMu.Lock()
+	defer tracker.commitMu.Unlock()
+
+	ready, ok := tracker.Done(msg)
+	if !ok {
+		return
+	}
+	if err := reader.CommitMessages(context.Background(), ready); err != nil {
+		// The next commit on this partition covers this offset too.
+		slog.Warn("Failed to commit offset", "topic", ready.Topic, "partition", ready.Partition, "offset", ready.Offset, "error", err)
+		return
+	}
+	slog.Debug("Message committed", "topic", ready.Topic, "partition", ready.Partition, "offset", ready.Offset)
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/segmentio/kafka-go"
+)
+
+func at(partition int, offset int64) kafka.Message {
+	return kafka.Message{Partition: partition, Offset: offset}
+}
+
+func TestOffsetTracker(t *testing.T) {
+	type step struct {
+		done       kafka.Message
+		wantCommit int64 // -1 when nothing may be committed yet
+	}
+	cases := []struct {
+		name    string
+		fetched []kafka.Message
+		steps   []step
+	}{
+		{"in order", []kafka.Message{at(0, 10), at(0, 11), at(0, 12)}, []step{
+			{at(0, 10), 10}, {at(0, 11), 11}, {at(0, 12), 12},
+		}},
+		{"out of order", []kafka.Message{at(0, 10), at(0, 11), at(0, 12)}, []step{
+			{at(0, 12), -1}, {at(0, 11), -1}, {at(0, 10), 12},
+		}},
+		{"held behind an unfinished job", []kafka.Message{at(0, 10), at(0, 11), at(0, 12), at(0, 13)}, []step{
+			{at(0, 10), 10}, {at(0, 12), -1}, {at(0, 13), -1}, {at(0, 11), 13},
+		}},
+		{"gaps in the offsets", []kafka.Message{at(0, 10), at(0, 14), at(0, 20)}, []step{
+			{at(0, 14), -1}, {at(0, 10), 14}, {at(0, 20), 20},
+		}},
+		// After a rebalance the same offsets can be fetched again. Each copy
+		// is tracked, and the commit never moves back for the second one.
+		{"redelivered offsets", []kafka.Message{at(0, 10), at(0, 11), at(0, 10), at(0, 11), at(0, 12)}, []step{
+			{at(0, 10), 10}, {at(0, 11), 11}, {at(0, 10), -1}, {at(0, 12), -1}, {at(0, 11), 12},
+		}},
+		{"redelivered while the first copy runs", []kafka.Message{at(0, 10), at(0, 11), at(0, 10)}, []step{
+			{at(0, 11), -1}, {at(0, 10), 11}, {at(0, 10), -1},
+		}},
+		{"both copies finish behind an earlier offset", []kafka.Message{at(0, 9), at(0, 10), at(0, 11), at(0, 10)}, []step{
+			{at(0, 10), -1}, {at(0, 10), -1}, {at(0, 11), -1}, {at(0, 9), 11},
+		}},
+		{"not fetched", []kafka.Message{at(0, 10)}, []step{
+			{at(1, 10), -1}, {at(0, 10), 10},
+		}},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			tracker := newOffsetTracker()
+			for _, m := range c.fetched {
+				tracker.Add(m)
+			}
+			for i, s := range c.steps {
+				got, ok := tracker.Done(s.done)
+				switch {
+				case s.wantCommit < 0 && ok:
+					t.Errorf("step %d: Done(%d) = commit %d, want nothing yet", i, s.done.Offset, got.Offset)
+				case s.wantCommit >= 0 && (!ok || got.Offset != s.wantCommit || got.Partition != s.done.Partition):
+					t.Errorf("step %d: Done(%d) = %d/%d, %v, want commit %d", i, s.done.Offset, got.Partition, got.Offset, ok, s.wantCommit)
+				}
+			}
+		})
+	}
+}
+
+// One slow partition never holds back another.
+func TestOffsetTrackerPartitions(t *testing.T) {
+	tracker := newOffsetTracker()
+	for _, m := range []kafka.Message{at(0, 5), at(1, 50), at(0, 6), at(1, 51), at(2, 7)} {
+		tracker.Add(m)
+	}
+
+	want := []struct {
+		done      kafka.Message
+		partition int
+		offset    int64
+		ok        bool
+	}{
+		{at(1, 51), 0, 0, false},
+		{at(2, 7), 2, 7, true},
+		{at(0, 6), 0, 0, false},
+		{at(1, 50), 1, 51, true},
+		{at(0, 5), 0, 6, true},
+	}
+	for _, w := range want {
+		got, ok := tracker.Done(w.done)
+		if ok != w.ok || ok && (got.Partition != w.partition || got.Offset != w.offset) {
+			t.Errorf("Done(%d/%d) = %d/%d, %v; want %d/%d, %v", w.done.Partition, w.done.Offset, got.Partition, got.Offset, ok, w.partition, w.offset, w.ok)
+		}
+	}
+	for id, p := range tracker.partitions {
+		if len(p.pending) != 0 || len(p.done) != 0 {
+			t.Errorf("partition %d still tracks %v pending, %d done", id, p.pending, len(p.done))
+		}
+	}
+}
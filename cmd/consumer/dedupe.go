@@ -0,0 +1,36 @@
+package main
+
+import (
+	"context"
+
+	"github.com/Mwambama/KafkaSync/internal/logging"
+	"github.com/Mwambama/KafkaSync/internal/model"
+	"github.com/minio/minio-go/v7"
+)
+
+// alreadyArchived reports whether this exact file (same remote, remote
+// location, name and hash) has been completed before, so a redelivered or
+// re-sent job can be skipped. Any lookup error errs on the side of
+// downloading again. local is the cleaned name the file was stored under.
+func alreadyArchived(ctx context.Context, r *remote, notification model.DownloadNotification, local string) bool {
+	if !conf.Dedupe.Enabled || notification.Force || notification.Hash == "" {
+		return false
+	}
+
+	found, err := db.Archived(ctx, r.name, notification.Origin(), notification.FileName(), notification.Hash)
+	if err != nil {
+		logging.FromContext(ctx).Warn("Duplicate check failed, downloading anyway", "error", err)
+		return false
+	}
+	if !found {
+		return false
+	}
+
+	if conf.Dedupe.CheckBucket {
+		if _, err := minioClient.StatObject(ctx, conf.ObjectStorage.Bucket, r.objectKey(local), minio.StatObjectOptions{}); err != nil {
+			logging.FromContext(ctx).Warn("Archived before but not in the bucket, downloading again", "error", err)
+			return false
+		}
+	}
+	return true
+}
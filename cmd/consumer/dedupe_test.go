@@ -0,0 +1,51 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/Mwambama/KafkaSync/internal/config"
+	"github.com/Mwambama/KafkaSync/internal/model"
+)
+
+func TestAlreadyArchived(t *testing.T) {
+	const hash = "sha256:2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824"
+	cases := []struct {
+		name     string
+		dedupe   config.Dedupe
+		hash     string
+		force    bool
+		archived string // hash the store has for report.csv
+		storeErr error
+		inBucket bool
+		want     bool
+	}{
+		{"archived", config.Dedupe{Enabled: true}, hash, false, hash, nil, false, true},
+		{"dedupe off", config.Dedupe{}, hash, false, hash, nil, true, false},
+		{"forced", config.Dedupe{Enabled: true, CheckBucket: true}, hash, true, hash, nil, true, false},
+		{"no hash", config.Dedupe{Enabled: true}, "", false, "", nil, true, false},
+		{"never archived", config.Dedupe{Enabled: true}, hash, false, "", nil, true, false},
+		{"archived with another hash", config.Dedupe{Enabled: true}, hash, false, "md5:5d41402abc4b2a76b9719d911017c592", nil, true, false},
+		{"store fails", config.Dedupe{Enabled: true}, hash, false, hash, errors.New("connection reset"), true, false},
+		{"still in the bucket", config.Dedupe{Enabled: true, CheckBucket: true}, hash, false, hash, nil, true, true},
+		{"gone from the bucket", config.Dedupe{Enabled: true, CheckBucket: true}, hash, false, hash, nil, false, false},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			r, store, objects := withConsumer(t, &fakeBackend{dir: t.TempDir()})
+			r.subpath = "eu"
+			conf.Dedupe = c.dedupe
+			store.archived = map[string]string{"report.csv": c.archived}
+			store.archivedErr = c.storeErr
+			if c.inBucket {
+				objects["/archive/eu/report.csv"] = []byte("id,amount\n")
+			}
+
+			n := model.DownloadNotification{Name: "report.csv", Location: "/in", Hash: c.hash, Force: c.force, Remote: r.name}
+			if got := alreadyArchived(context.Background(), r, n, "report.csv"); got != c.want {
+				t.Errorf("alreadyArchived = %v, want %v", got, c.want)
+			}
+		})
+	}
+}
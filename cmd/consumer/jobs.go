@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"github.com/Mwambama/KafkaSync/internal/logging"
+	"github.com/Mwambama/KafkaSync/internal/model"
+
+	"github.com/Mwambama/KafkaSync/internal/queue"
+	"github.com/segmentio/kafka-go"
+)
+
+// transitions lists the states each lifecycle state may move to.
+var transitions = map[string][]string{
+	"":                     {model.StateReceived},
+	model.StateReceived:    {model.StateDownloading, model.StateMirroring, model.StateDone, model.StateFailed, model.StateDeferred},
+	model.StateMirroring:   {model.StateDone, model.StateFailed},
+	model.StateDownloading: {model.StateVerifying, model.StateFailed},
+	model.StateVerifying:   {model.StateMoving, model.StateFailed},
+	model.StateMoving:      {model.StateUploading, model.StateFailed},
+	model.StateUploading:   {model.StateDone, model.StateFailed},
+	model.StateDone:        {model.StateReceived},
+	model.StateFailed:      {model.StateReceived},
+	model.StateDeferred:    {model.StateReceived},
+}
+
+// job is one attempt at processing a notification. Its transitions are
+// written to `jobs` (current state) and `job_events` (append-only history).
+// Per-key ordering means only one goroutine ever drives a given job.
+type job struct {
+	ID           string
+	Remote       string // resolved remote name, see remoteName
+	Parent       string // the mirror job this file belongs to, if any
+	Attempt      int
+	Notification model.DownloadNotification
+	state        string
+	log          *slog.Logger          // carries job_id and Kafka coordinates
+	looks        map[string]queue.Look // the stable policy's looks, shared with a mirror's files
+}
+
+// jobID prefers the ID in the payload, then the one a retry or DLQ hop
+// carried in its headers, and finally derives one from where the message
+// first landed so legacy producers still get a stable timeline.
+func jobID(message kafka.Message, notification model.DownloadNotification) string {
+	if notification.JobID != "" {
+		return notification.JobID
+	}
+	if id := queue.Header(message, queue.HeaderJobID); id != "" {
+		return id
+	}
+	return fmt.Sprintf("%s-%d-%d", message.Topic, message.Partition, message.Offset)
+}
+
+func terminal(state string) bool {
+	return state == "" || state == model.StateDone || state == model.StateFailed || state == model.StateDeferred
+}
+
+// trackInFlight keeps the in-flight gauges in step with a transition.
+func trackInFlight(from, to string) {
+	if !terminal(from) {
+		jobsInState.Dec(from)
+	}
+	if !terminal(to) {
+		jobsInState.Inc(to)
+	}
+	switch {
+	case terminal(from) && !terminal(to):
+		jobsInFlight.Inc()
+	case !terminal(from) && terminal(to):
+		jobsInFlight.Dec()
+	}
+}
+
+// startJob (re)registers the job in RECEIVED. parent is empty except for
+// the files of a mirror job.
+func startJob(ctx context.Context, id, parent string, notification model.DownloadNotification, attempt int) *job {
+	j := &job{ID: id, Remote: remoteName(notification), Parent: parent, Attempt: attempt, Notification: notification, log: logging.FromContext(ctx)}
+	if err := db.StartJob(context.Background(), id, parent, j.Remote, notification, attempt); err != nil {
+		j.log.Warn("Failed to register job", "error", err)
+	}
+	j.record(model.StateReceived, "")
+	return j
+}
+
+// to moves the job to the next pipeline state.
+func (j *job) to(state string) {
+	j.transition(state, "", "")
+}
+
+// finish ends the attempt in DONE, or FAILED when err is set, keeping the
+// detailed pipeline status (COMPLETED_AND_UPLOADED, HASH_MISMATCH, ...).
+func (j *job) finish(status string, err error) {
+	if err == nil {
+		j.transition(model.StateDone, status, status)
+		return
+	}
+	j.transition(model.StateFailed, status, fmt.Sprintf("%s: %v", status, err))
+}
+
+// deferred ends the attempt in DEFERRED: the file was not ready, and the
+// job will be tried again later.
+func (j *job) deferred(status string, err error) {
+	j.transition(model.StateDeferred, status, fmt.Sprintf("%s: %v", status, err))
+}
+
+func (j *job) transition(state, status, detail string) {
+	allowed := false
+	for _, next := range transitions[j.state] {
+		if next == state {
+			allowed = true
+			break
+		}
+	}
+	if !allowed {
+		j.log.Warn("Invalid job transition", "from", j.state, "to", state)
+		return
+	}
+
+	if err := db.SetJobState(context.Background(), j.ID, state, status); err != nil {
+		j.log.Warn("Failed to update job", "error", err)
+	}
+	j.record(state, detail)
+}
+
+func (j *job) record(state, detail string) {
+	trackInFlight(j.state, state)
+	j.log.Debug("job state", "from", j.state, "to", state)
+	j.state = state
+	if err := db.AddJobEvent(context.Background(), j.ID, state, j.Attempt, detail); err != nil {
+		j.log.Warn("Failed to record job event", "state", state, "error", err)
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/Mwambama/KafkaSync/internal/model"
+)
+
+func TestJobTransitions(t *testing.T) {
+	cases := []struct {
+		name  string
+		steps []string // states to move to after RECEIVED, in order
+		want  []string // states recorded, RECEIVED first
+	}{
+		{"download", []string{model.StateDownloading, model.StateVerifying, model.StateMoving, model.StateUploading, model.StateDone},
+			[]string{model.StateReceived, model.StateDownloading, model.StateVerifying, model.StateMoving, model.StateUploading, model.StateDone}},
+		{"mirror", []string{model.StateMirroring, model.StateDone},
+			[]string{model.StateReceived, model.StateMirroring, model.StateDone}},
+		{"skipped", []string{model.StateDone},
+			[]string{model.StateReceived, model.StateDone}},
+		{"deferred", []string{model.StateDeferred},
+			[]string{model.StateReceived, model.StateDeferred}},
+		{"fails mid-way", []string{model.StateDownloading, model.StateVerifying, model.StateFailed},
+			[]string{model.StateReceived, model.StateDownloading, model.StateVerifying, model.StateFailed}},
+		{"skips a stage", []string{model.StateDownloading, model.StateMoving, model.StateVerifying},
+			[]string{model.StateReceived, model.StateDownloading, model.StateVerifying}},
+		{"goes back", []string{model.StateDownloading, model.StateVerifying, model.StateDownloading},
+			[]string{model.StateReceived, model.StateDownloading, model.StateVerifying}},
+		{"uploads without downloading", []string{model.StateUploading, model.StateDone},
+			[]string{model.StateReceived, model.StateDone}},
+		{"mirror downloads itself", []string{model.StateMirroring, model.StateDownloading, model.StateFailed},
+			[]string{model.StateReceived, model.StateMirroring, model.StateFailed}},
+		{"nothing after the end", []string{model.StateFailed, model.StateDownloading, model.StateDone, model.StateDeferred},
+			[]string{model.StateReceived, model.StateFailed}},
+		{"deferred only from received", []string{model.StateDownloading, model.StateDeferred},
+			[]string{model.StateReceived, model.StateDownloading}},
+		{"unknown state", []string{"PAUSED", model.StateDone},
+			[]string{model.StateReceived, model.StateDone}},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			_, store, _ := withConsumer(t, &fakeBackend{dir: t.TempDir()})
+			n := model.DownloadNotification{JobID: "job-1", Name: "report.csv", Location: "/in"}
+			j := startJob(context.Background(), n.JobID, "", n, 1)
+			for _, state := range c.steps {
+				j.to(state)
+			}
+			if got := store.states[n.JobID]; !reflect.DeepEqual(got, c.want) {
+				t.Errorf("states = %v, want %v", got, c.want)
+			}
+			if j.state != c.want[len(c.want)-1] {
+				t.Errorf("job in %s, want %s", j.state, c.want[len(c.want)-1])
+			}
+		})
+	}
+}
+
+// Every attempt after the first starts again from RECEIVED, whatever the
+// last one ended in.
+func TestTransitionTable(t *testing.T) {
+	for _, end := range []string{model.StateDone, model.StateFailed, model.StateDeferred} {
+		if !reflect.DeepEqual(transitions[end], []string{model.StateReceived}) {
+			t.Errorf("%s may move to %v, want only %s", end, transitions[end], model.StateReceived)
+		}
+	}
+	// And every state the pipeline records can be reached and left.
+	reached := map[string]bool{}
+	for from, next := range transitions {
+		for _, to := range next {
+			reached[to] = true
+			if _, ok := transitions[to]; !ok {
+				t.Errorf("%s moves to %s, which has no transitions of its own", from, to)
+			}
+		}
+	}
+	for state := range transitions {
+		if state != "" && !reached[state] {
+			t.Errorf("nothing moves to %s", state)
+		}
+	}
+}
@@ -2,85 +2,48 @@ package main
 
 import (
 	"context"
-	"database/sql"
-	"encoding/json"
+	"flag"
 	"fmt"
-	"io"
 	"log"
+	"log/slog"
+	"net/http"
 	"os"
-	"os/exec"
-	"path/filepath"
-	"strings"
-	"time"
-
-	"github.com/BurntSushi/toml"
-	_ "github.com/lib/pq"
+	"os/signal"
+	"syscall"
+
+	"github.com/Mwambama/KafkaSync/internal/config"
+	"github.com/Mwambama/KafkaSync/internal/logging"
+	"github.com/Mwambama/KafkaSync/internal/model"
+	"github.com/Mwambama/KafkaSync/internal/queue"
+	"github.com/Mwambama/KafkaSync/internal/store"
+	"github.com/Mwambama/KafkaSync/internal/transfer"
 	"github.com/minio/minio-go/v7"
 	"github.com/minio/minio-go/v7/pkg/credentials"
 	"github.com/segmentio/kafka-go"
 )
 
-type DownloadNotification struct {
-	Hash     string `json:"info_hash"`
-	Name     string `json:"name"`
-	Location string `json:"location"`
-}
-
-type tomlConfig struct {
-	KafkaUrl      string         `toml:"kafka_url"`
-	NumThreads    int            `toml:"num_threads"`
-	DebugLevel    string         `toml:"debug_level"`
-	RemoteDetails remoteDetails  `toml:"remoteDetails"`
-	Locations     locations      `toml:"locations"`
-	Database      databaseConfig `toml:"database"`
-	ObjectStorage s3Config       `toml:"objectStorage"` // ✅ New S3 config
-}
-
-type remoteDetails struct {
-	Host     string
-	Username string
-	Password string
-}
-
-type locations struct {
-	Incompletes string
-	Completes   string
-}
-
-type databaseConfig struct {
-	Host     string
-	Port     int
-	User     string
-	Password string
-	DbName   string
-}
-
-type s3Config struct {
-	Endpoint  string `toml:"endpoint"`
-	AccessKey string `toml:"access_key"` // <--- Tag tells Go to read "access_key"
-	SecretKey string `toml:"secret_key"` // <--- Tag tells Go to read "secret_key"
-	Bucket    string `toml:"bucket"`
-	UseSSL    bool   `toml:"use_ssl"`
-	Region    string `toml:"region"`
-}
-
-// ✅ S3 / MinIO Config but uses the tomlConfig definition bt does not read it right
-// type s3Config struct {
-// 	Endpoint  string
-// 	AccessKey string
-// 	SecretKey string
-// 	Bucket    string
-// 	UseSSL    bool
-// 	Region    string
-// }
-
-var conf tomlConfig
-var db *sql.DB
+var conf *config.Config
+var db jobStore
 var minioClient *minio.Client // ✅ Global S3 Client
+var s3Transport *http.Transport
+var dlqWriter *kafka.Writer // nil when no dead-letter topic is configured
+var instanceID string
 
-func init() {
-	if _, err := toml.DecodeFile("config.toml", &conf); err != nil {
-		log.Fatalf("❌ Failed to load config: %v", err)
+// loadConfig reads and validates the config before anything else starts,
+// so every problem is reported at once.
+func loadConfig(path string) {
+	var err error
+	if conf, err = config.Load(path); err == nil {
+		err = conf.Validate(config.NeedKafka | config.NeedDatabase | config.NeedRemote | config.NeedStorage)
+	}
+	if err != nil {
+		log.Fatalf("Failed to load config %s: %v", path, err)
+	}
+
+	instanceID = conf.InstanceID
+	if instanceID == "" {
+		host, _ := os.Hostname()
+		instanceID = fmt.Sprintf("%s-%d", host, os.Getpid())
 	}
 }
 
@@ -91,65 +54,62 @@ func ensureDir(path string) error {
 	return nil
 }
 
-func initDB() {
-	connStr := fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=disable",
-		conf.Database.Host, conf.Database.Port, conf.Database.User, conf.Database.Password, conf.Database.DbName)
+// jobStore is the part of store.Store the consumer uses, so tests can run
+// jobs without Postgres.
+type jobStore interface {
+	transfer.HostKeyStore
+	StartJob(ctx context.Context, id, parent, remote string, n model.DownloadNotification, attempt int) error
+	SetJobState(ctx context.Context, id, state, status string) error
+	AddJobEvent(ctx context.Context, id, state string, attempt int, detail string) error
+	RecordDownload(ctx context.Context, d model.Download) error
+	Completed(ctx context.Context, jobID string) (int64, bool, error)
+	Archived(ctx context.Context, remote, location, name, hash string) (bool, error)
+	Close() error
+}
 
+func initDB() {
 	var err error
-	db, err = sql.Open("postgres", connStr)
-	if err != nil {
-		log.Fatalf("❌ Failed to connect to database: %v", err)
-	}
-	if err = db.Ping(); err != nil {
-		log.Fatalf("❌ Database unreachable: %v", err)
-	}
-	log.Println("✅ Connected to PostgreSQL database")
-
-	query := `
-	CREATE TABLE IF NOT EXISTS downloads (
-		id SERIAL PRIMARY KEY,
-		filename TEXT NOT NULL,
-		remote_location TEXT,
-		hash TEXT,
-		status TEXT,
-		downloaded_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
-	);`
-	if _, err := db.Exec(query); err != nil {
-		log.Fatalf("❌ Failed to create table: %v", err)
+	if db, err = store.Connect(conf.Database); err != nil {
+		logging.Fatal("Failed to connect to database", "error", err)
 	}
+	slog.Info("Connected to PostgreSQL database")
 }
 
 // ✅ Initialize MinIO/S3
 func initS3() {
 	var err error
+	s3Transport, err = minio.DefaultTransport(conf.ObjectStorage.UseSSL)
+	if err != nil {
+		logging.Fatal("Failed to create S3 transport", "error", err)
+	}
 	minioClient, err = minio.New(conf.ObjectStorage.Endpoint, &minio.Options{
-		Creds:  credentials.NewStaticV4(conf.ObjectStorage.AccessKey, conf.ObjectStorage.SecretKey, ""),
-		Secure: conf.ObjectStorage.UseSSL,
+		Creds:     credentials.NewStaticV4(conf.ObjectStorage.AccessKey, conf.ObjectStorage.SecretKey, ""),
+		Secure:    conf.ObjectStorage.UseSSL,
+		Transport: s3Transport,
 	})
 	if err != nil {
-		log.Fatalf("❌ Failed to create S3 client: %v", err)
+		logging.Fatal("Failed to create S3 client", "error", err)
 	}
 
 	// Check connection by checking/creating bucket
 	ctx := context.Background()
 	exists, err := minioClient.BucketExists(ctx, conf.ObjectStorage.Bucket)
 	if err != nil {
-		log.Fatalf("❌ Failed to connect to S3/MinIO: %v", err)
+		logging.Fatal("Failed to connect to S3/MinIO", "error", err)
 	}
 	if !exists {
 		err = minioClient.MakeBucket(ctx, conf.ObjectStorage.Bucket, minio.MakeBucketOptions{Region: conf.ObjectStorage.Region})
 		if err != nil {
-			log.Fatalf("❌ Failed to create bucket: %v", err)
+			logging.Fatal("Failed to create bucket", "bucket", conf.ObjectStorage.Bucket, "error", err)
 		}
-		log.Printf("✅ Created new bucket: %s", conf.ObjectStorage.Bucket)
+		slog.Info("Created new bucket", "bucket", conf.ObjectStorage.Bucket)
 	} else {
-		log.Printf("✅ Connected to S3 Bucket: %s", conf.ObjectStorage.Bucket)
+		slog.Info("Connected to S3 Bucket", "bucket", conf.ObjectStorage.Bucket)
 	}
 }
 
 // ✅ Upload file to S3
-func uploadToStorage(filePath string, filename string) error {
-	ctx := context.Background()
+func uploadToStorage(ctx context.Context, filePath string, filename string) error {
 	contentType := "application/octet-stream"
 
 	// Upload the file
@@ -158,125 +118,113 @@ func uploadToStorage(filePath string, filename string) error {
 		return err
 	}
 
-	log.Printf("☁️  Successfully uploaded %s to cloud (Size: %d bytes)", filename, info.Size)
+	logging.FromContext(ctx).Info("Successfully uploaded to cloud", "object", filename, "bytes", info.Size)
 	return nil
 }
 
-func recordDownload(notification DownloadNotification, status string) {
-	query := `INSERT INTO downloads (filename, remote_location, hash, status) VALUES ($1, $2, $3, $4)`
-	_, err := db.Exec(query, notification.Name, notification.Location, notification.Hash, status)
+// recordDownload appends one row per attempt to downloads, with enough
+// transfer and Kafka detail to debug a slow or failing job from the table.
+func recordDownload(message kafka.Message, j *job, result jobResult) {
+	err := db.RecordDownload(context.Background(), model.Download{
+		JobID:          j.ID,
+		Remote:         j.Remote,
+		Notification:   j.Notification,
+		Status:         result.Status,
+		Attempt:        j.Attempt,
+		Err:            result.Err,
+		Size:           result.Size,
+		DownloadTime:   result.DownloadTime,
+		UploadTime:     result.UploadTime,
+		KafkaTopic:     message.Topic,
+		KafkaPartition: message.Partition,
+		KafkaOffset:    message.Offset,
+		MessageTime:    message.Time,
+		ConsumerID:     instanceID,
+	})
 	if err != nil {
-		log.Printf("⚠️ Failed to log to DB: %v", err)
+		j.log.Warn("Failed to log to DB", "error", err)
 	} else {
-		log.Println("🗂️  Download recorded in database")
+		j.log.Debug("Download recorded in database", "status", result.Status)
 	}
 }
 
 func main() {
-	logFile, err := os.OpenFile("consumer.log", os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	configPath := flag.String("config", config.Path(), "path to config.toml")
+	flag.Parse()
+	loadConfig(*configPath)
+
+	logFile, err := logging.Setup(conf.LogConfig().WithDefaults("both", "consumer.log"), conf.Secrets()...)
 	if err != nil {
-		fmt.Printf("❌ Failed to open log file: %v\n", err)
-		return
+		log.Fatalf("Failed to set up logging: %v", err)
 	}
 	defer logFile.Close()
-	log.SetOutput(io.MultiWriter(os.Stdout, logFile))
-	log.SetFlags(log.LstdFlags | log.Lmsgprefix)
-
-	if err := ensureDir(conf.Locations.Incompletes); err != nil {
-		log.Fatalf("❌ Failed to create incompletes directory: %v", err)
-	}
-	if err := ensureDir(conf.Locations.Completes); err != nil {
-		log.Fatalf("❌ Failed to create completes directory: %v", err)
-	}
+	slog.SetDefault(slog.Default().With("consumer_id", instanceID))
 
 	initDB()
+	// After initDB: trust-on-first-use keeps host keys in the database.
+	// Also creates each remote's incompletes and completes.
+	initRemotes()
 	initS3() // Connect to Cloud
 
+	// No CommitInterval: offsets are committed explicitly once a job has
+	// reached a terminal state, so a crash mid-transfer redelivers the job.
 	reader := kafka.NewReader(kafka.ReaderConfig{
-		Brokers:        []string{conf.KafkaUrl},
-		Topic:          "kafkasync-files",
-		GroupID:        "file-consumer-group",
-		MinBytes:       1,
-		MaxBytes:       10e6,
-		CommitInterval: time.Second,
+		Brokers:  []string{conf.KafkaUrl},
+		Topic:    queue.MainTopic,
+		GroupID:  "file-consumer-group",
+		MinBytes: 1,
+		MaxBytes: 10e6,
 	})
-	defer reader.Close()
 
-	log.Println("✅ Kafka consumer is now listening for messages...")
-
-	for {
-		ctx := context.TODO()
-		message, err := reader.ReadMessage(ctx)
-		if err != nil {
-			log.Printf("❌ Error reading message: %v", err)
-			continue
-		}
-
-		var notification DownloadNotification
-		if err := json.Unmarshal(message.Value, &notification); err != nil {
-			log.Printf("❌ Failed to parse JSON message: %v\n", err)
-			continue
+	if conf.DeadLetter.Topic != "" {
+		dlqWriter = &kafka.Writer{
+			Addr:                   kafka.TCP(conf.KafkaUrl),
+			Topic:                  conf.DeadLetter.Topic,
+			Balancer:               &kafka.Hash{},
+			RequiredAcks:           kafka.RequireAll,
+			AllowAutoTopicCreation: true,
 		}
+		slog.Info("Dead-letter topic", "dlq_topic", conf.DeadLetter.Topic)
+	}
 
-		log.Printf("⬇️  Preparing to download: %+v\n", notification)
+	watchReader(reader)
+	stopMetrics := serveMetrics()
 
-		remoteCommand := genRemoteCommand(notification.Location, notification.Name)
-		cmd := exec.Command("wsl.exe", "lftp", "-e", remoteCommand)
-		cmd.Dir = conf.Locations.Incompletes
+	tracker := newOffsetTracker()
 
-		if conf.DebugLevel == "debug" {
-			log.Printf("🛠 Executing command: %s", cmd.String())
-			cmd.Stdout = os.Stdout
-			cmd.Stderr = os.Stderr
-		}
-		log.Printf("🚀 Running download...")
+	// ctx stops fetching on SIGINT/SIGTERM; jobCtx is only cancelled once
+	// in-flight jobs have had their grace period.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	jobCtx, cancelJobs := context.WithCancel(context.Background())
+	defer cancelJobs()
 
-		if err := cmd.Run(); err != nil {
-			log.Printf("❌ Download failed for %s: %v", notification.Name, err)
-			recordDownload(notification, "FAILED")
-			continue
-		}
+	initRetry(ctx)
 
-		from := filepath.Join(conf.Locations.Incompletes, notification.Name)
-		if _, err := os.Stat(from); os.IsNotExist(err) {
-			log.Printf("❌ File not found after download: %s", from)
-			recordDownload(notification, "MISSING")
-			continue
+	pool := newWorkerPool(conf.ConcurrentJobs, func(message kafka.Message) {
+		if handleMessage(jobCtx, message) {
+			commit(reader, tracker, message)
 		}
+	})
 
-		to := filepath.Join(conf.Locations.Completes, notification.Name)
-		if err = os.Rename(from, to); err != nil {
-			log.Printf("❌ Failed to move %s to completes: %v", notification.Name, err)
-			recordDownload(notification, "MOVE_FAILED")
-			continue
-		}
-		log.Printf("✅ File moved to completed: %s", to)
+	slog.Info("Kafka consumer is now listening for messages", "topic", queue.MainTopic, "concurrent_jobs", cap(pool.running))
 
-		// Upload to Cloud
-		err = uploadToStorage(to, notification.Name)
+	for ctx.Err() == nil {
+		message, err := reader.FetchMessage(ctx)
 		if err != nil {
-			log.Printf("❌ Failed to upload to S3: %v", err)
-			recordDownload(notification, "UPLOAD_FAILED")
-		} else {
-			recordDownload(notification, "COMPLETED_AND_UPLOADED")
+			if ctx.Err() == nil {
+				slog.Error("Error reading message", "error", err)
+			}
+			continue
 		}
-
-		log.Printf("📨 Message committed for %s", notification.Name)
+		tracker.Add(message)
+		pool.Submit(ctx, message)
 	}
-}
-
-func genRemoteCommand(location, name string) string {
-	safeName := strings.ReplaceAll(name, " ", "\\ ")
-	safeName = strings.ReplaceAll(safeName, "'", "\\'")
-
-	fullRemote := fmt.Sprintf("sftp://%s:%s@%s%s/%s",
-		conf.RemoteDetails.Username,
-		conf.RemoteDetails.Password,
-		conf.RemoteDetails.Host,
-		location,
-		safeName,
-	)
 
-	lftpCommand := fmt.Sprintf("pget -n %d -c %s", conf.NumThreads, fullRemote)
-	return fmt.Sprintf("set sftp:auto-confirm yes; %s; bye", lftpCommand)
+	stop()
+	slog.Info("Shutdown requested, waiting for in-flight jobs", "grace", shutdownGrace())
+	drain(pool, shutdownGrace(), cancelJobs)
+	retryWG.Wait()
+	stopMetrics()
+	shutdown(reader)
 }
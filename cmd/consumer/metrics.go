@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/Mwambama/KafkaSync/internal/metrics"
+	"github.com/segmentio/kafka-go"
+)
+
+var (
+	registry = metrics.NewRegistry()
+
+	jobsTotal = registry.NewCounterVec("kafkasync_jobs_total",
+		"Jobs finished, by final status.", "status")
+	jobsInFlight = registry.NewGauge("kafkasync_jobs_in_flight",
+		"Jobs currently being processed.")
+	jobsInState = registry.NewGaugeVec("kafkasync_jobs_in_state",
+		"In-flight jobs by lifecycle state.", "state")
+
+	downloadSeconds = registry.NewHistogram("kafkasync_download_duration_seconds",
+		"Time spent fetching a file from the remote.", metrics.ExponentialBuckets(0.1, 2, 16))
+	uploadSeconds = registry.NewHistogram("kafkasync_upload_duration_seconds",
+		"Time spent uploading a file to object storage.", metrics.ExponentialBuckets(0.1, 2, 16))
+	downloadBytes = registry.NewHistogram("kafkasync_download_bytes",
+		"Size of downloaded files.", metrics.ExponentialBuckets(1024, 4, 12))
+
+	kafkaLag        = registry.NewGauge("kafkasync_kafka_lag", "Messages behind the end of the assigned partitions.")
+	kafkaOffset     = registry.NewGauge("kafkasync_kafka_offset", "Current reader offset.")
+	kafkaMessages   = registry.NewCounter("kafkasync_kafka_messages_total", "Messages fetched from Kafka.")
+	kafkaBytes      = registry.NewCounter("kafkasync_kafka_bytes_total", "Bytes fetched from Kafka.")
+	kafkaFetches    = registry.NewCounter("kafkasync_kafka_fetches_total", "Fetch requests sent to Kafka.")
+	kafkaErrors     = registry.NewCounter("kafkasync_kafka_fetch_errors_total", "Errors returned while fetching from Kafka.")
+	kafkaTimeouts   = registry.NewCounter("kafkasync_kafka_timeouts_total", "Fetch timeouts.")
+	kafkaRebalances = registry.NewCounter("kafkasync_kafka_rebalances_total", "Consumer group rebalances.")
+)
+
+// observeJob records the outcome of one job attempt.
+func observeJob(result jobResult) {
+	jobsTotal.Inc(result.Status)
+	if result.DownloadTime > 0 {
+		downloadSeconds.Observe(result.DownloadTime.Seconds())
+	}
+	if result.Size > 0 {
+		downloadBytes.Observe(float64(result.Size))
+	}
+	if result.UploadTime > 0 {
+		uploadSeconds.Observe(result.UploadTime.Seconds())
+	}
+}
+
+// watchReader exports reader.Stats() on every scrape. kafka-go resets its
+// counters each time Stats is called, so they are added as deltas.
+func watchReader(reader *kafka.Reader) {
+	registry.OnScrape(func() {
+		s := reader.Stats()
+		kafkaLag.Set(float64(s.Lag))
+		kafkaOffset.Set(float64(s.Offset))
+		kafkaMessages.Add(float64(s.Messages))
+		kafkaBytes.Add(float64(s.Bytes))
+		kafkaFetches.Add(float64(s.Fetches))
+		kafkaErrors.Add(float64(s.Errors))
+		kafkaTimeouts.Add(float64(s.Timeouts))
+		kafkaRebalances.Add(float64(s.Rebalances))
+	})
+}
+
+// serveMetrics starts the /metrics endpoint if metrics_addr is set. The
+// returned function stops it.
+func serveMetrics() func() {
+	if conf.MetricsAddr == "" {
+		return func() {}
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", registry.Handler())
+	srv := &http.Server{Addr: conf.MetricsAddr, Handler: mux}
+
+	go func() {
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			slog.Error("Metrics server stopped", "error", err)
+		}
+	}()
+	slog.Info("Serving Prometheus metrics", "addr", conf.MetricsAddr, "path", "/metrics")
+
+	return func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		srv.Shutdown(ctx)
+	}
+}
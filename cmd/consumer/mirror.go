@@ -0,0 +1,200 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/Mwambama/KafkaSync/internal/logging"
+	"github.com/Mwambama/KafkaSync/internal/model"
+	"github.com/Mwambama/KafkaSync/internal/queue"
+	"github.com/Mwambama/KafkaSync/internal/retry"
+	"github.com/Mwambama/KafkaSync/internal/safepath"
+	"github.com/Mwambama/KafkaSync/internal/transfer"
+	"github.com/google/uuid"
+	"github.com/segmentio/kafka-go"
+)
+
+// mirror copies a remote directory into completes/<root> and the bucket.
+// Every file is a job of its own with the mirror as its parent, run one
+// after another. A retry skips files an earlier attempt already uploaded,
+// so only the ones that failed are fetched again.
+func mirror(ctx context.Context, message kafka.Message, j *job, r *remote, root string) jobResult {
+	n := j.Notification
+	prefix, err := mirrorPrefix(n, root)
+	if err != nil {
+		j.log.Error("Invalid mirror job", "error", err)
+		return failed("BAD_MIRROR", queue.StageDownload, retry.MarkPermanent(err))
+	}
+	lister, ok := r.fetcher.(transfer.Lister)
+	if !ok {
+		err := retry.MarkPermanent(fmt.Errorf("%w: the %s backend cannot list directories", transfer.ErrSource, r.transfer.Backend))
+		j.log.Error("Remote cannot mirror", "error", err)
+		return failed("UNSUPPORTED_SOURCE", queue.StageDownload, err)
+	}
+
+	j.to(model.StateMirroring)
+	entries, err := lister.List(ctx, transfer.Job{Location: n.Location, Name: n.Name, Source: n.Source})
+	switch {
+	case errors.Is(err, transfer.ErrUnsafeName):
+		j.log.Error("Rejected directory name", "error", err)
+		return failed("REJECTED_NAME", queue.StageDownload, err)
+	case errors.Is(err, transfer.ErrSource):
+		j.log.Error("Remote cannot fetch this source", "error", err)
+		return failed("UNSUPPORTED_SOURCE", queue.StageDownload, err)
+	case errors.Is(err, transfer.ErrHostKey):
+		j.log.Error("Host key verification failed", "error", err)
+		return failed("HOST_KEY_MISMATCH", queue.StageDownload, err)
+	case err != nil:
+		j.log.Error("Listing failed", "error", err)
+		return failed("FAILED", queue.StageDownload, err)
+	}
+
+	var total jobResult
+	var failures, notReady []error
+	transient, done := false, 0
+	for _, e := range entries {
+		if !transfer.Selected(e.Path, n.Include, n.Exclude) {
+			continue
+		}
+		if ctx.Err() != nil {
+			total.Status, total.Err = "INTERRUPTED", ctx.Err()
+			return total
+		}
+		result := mirrorFile(ctx, message, j, r, root, prefix, e)
+		total.Size += result.Size
+		total.DownloadTime += result.DownloadTime
+		total.UploadTime += result.UploadTime
+		if result.Err == nil {
+			done++
+			continue
+		}
+		if ctx.Err() != nil {
+			total.Status, total.Err = "INTERRUPTED", ctx.Err()
+			return total
+		}
+		if result.Status == statusNotReady {
+			notReady = append(notReady, fmt.Errorf("%s: %w", e.Path, result.Err))
+			continue
+		}
+		failures = append(failures, fmt.Errorf("%s: %w", e.Path, result.Err))
+		transient = transient || retry.Classify(result.Err) == retry.Transient
+	}
+
+	j.log.Info("Mirror finished", "files", done+len(failures)+len(notReady), "failed", len(failures), "not_ready", len(notReady), "bytes", total.Size)
+	switch {
+	case len(failures) == 0 && len(notReady) == 0:
+		total.Status = "COMPLETED_AND_UPLOADED"
+		return total
+	case len(failures) == 0:
+		// Deferred as a whole, like a single file that is not ready; the
+		// files already uploaded are skipped next time.
+		total.Status, total.Stage = statusNotReady, queue.StageDownload
+		total.Err = retry.MarkTransient(errors.Join(notReady...))
+		return total
+	}
+	// Alongside real failures, files that are not ready yet are retried
+	// with them.
+	failures = append(failures, notReady...)
+	transient = transient || len(notReady) > 0
+	total.Status, total.Stage = "PARTIAL", queue.StageDownload
+	if done == 0 {
+		total.Status = "FAILED"
+	}
+	// Retrying is only worth it if some file may still succeed.
+	total.Err = retry.MarkPermanent(errors.Join(failures...))
+	if transient {
+		total.Err = retry.MarkTransient(errors.Join(failures...))
+	}
+	return total
+}
+
+// mirrorFile runs one file of a mirror as a child job. Its ID is derived
+// from the parent's and the file's path, so every attempt at the mirror
+// updates the same child.
+func mirrorFile(ctx context.Context, message kafka.Message, parent *job, r *remote, root, prefix string, e transfer.Entry) jobResult {
+	n := parent.Notification
+	id := uuid.NewSHA1(uuid.NameSpaceURL, []byte(parent.ID+"\x00"+e.Path)).String()
+	child := model.DownloadNotification{
+		JobID:  id,
+		Name:   e.Path,
+		Force:  n.Force,
+		Remote: r.name,
+	}
+	if n.Source != "" {
+		child.Source = sourceChild(n.Source, e.Path)
+	} else {
+		child.Location = path.Join(n.Location, n.Name)
+	}
+
+	ctx = logging.NewContext(ctx, parent.log.With("child_id", id, "path", e.Path))
+	c := startJob(ctx, id, parent.ID, child, parent.Attempt)
+	c.looks = parent.looks
+	result := mirrorChild(ctx, c, r, root, prefix, e)
+	if result.Err == nil {
+		delete(parent.looks, child.Name) // nothing left to wait for
+	}
+	if result.Err != nil && ctx.Err() != nil {
+		result.Status = "INTERRUPTED"
+	}
+	if result.Status == statusNotReady {
+		// The parent is deferred, or retried, as a whole.
+		c.deferred(result.Status, result.Err)
+	} else {
+		c.finish(result.Status, result.Err)
+	}
+	recordDownload(message, c, result)
+	observeJob(result)
+	return result
+}
+
+func mirrorChild(ctx context.Context, c *job, r *remote, root, prefix string, e transfer.Entry) jobResult {
+	rel, err := safepath.Clean(e.Path)
+	if err != nil {
+		c.log.Error("Rejected file name", "error", err)
+		return failed("REJECTED_NAME", queue.StageDownload, retry.MarkPermanent(err))
+	}
+	if !c.Notification.Force {
+		size, ok, err := db.Completed(ctx, c.ID)
+		if err != nil {
+			c.log.Warn("Could not check earlier attempts, downloading anyway", "error", err)
+		} else if ok && (e.Size < 0 || size == e.Size) {
+			c.log.Info("Uploaded by an earlier attempt, skipping")
+			return jobResult{Status: "SKIPPED_DUPLICATE"}
+		}
+	}
+	return processFile(ctx, c, r, file{
+		Job: transfer.Job{
+			Location:  c.Notification.Location,
+			Name:      c.Notification.Name,
+			LocalName: path.Join(root, rel),
+			Source:    c.Notification.Source,
+		},
+		key: r.objectKey(path.Join(prefix, rel)),
+	})
+}
+
+// mirrorPrefix checks the job's globs and returns where its files go in
+// the bucket: Prefix, or the directory's own name.
+func mirrorPrefix(n model.DownloadNotification, root string) (string, error) {
+	if err := transfer.CheckGlobs(append(append([]string(nil), n.Include...), n.Exclude...)...); err != nil {
+		return "", err
+	}
+	if n.Prefix == "" {
+		return root, nil
+	}
+	return safepath.Clean(strings.Trim(n.Prefix, "/"))
+}
+
+// sourceChild is the URI of a file under a mirrored source directory.
+func sourceChild(source, rel string) string {
+	u, err := url.Parse(source)
+	if err != nil {
+		return source // List already rejected it
+	}
+	u.Path, u.RawPath = path.Join(u.Path, rel), ""
+	return u.String()
+}
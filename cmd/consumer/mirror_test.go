@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/Mwambama/KafkaSync/internal/model"
+	"github.com/Mwambama/KafkaSync/internal/retry"
+	"github.com/Mwambama/KafkaSync/internal/transfer"
+	"github.com/segmentio/kafka-go"
+)
+
+// fakeTree is a fakeBackend that can also list and stat its files. listed
+// adds entries to every listing that the backend then cannot fetch.
+type fakeTree struct {
+	*fakeBackend
+	listed []string
+}
+
+func (f *fakeTree) List(ctx context.Context, job transfer.Job) ([]transfer.Entry, error) {
+	dir := path.Join(job.Location, job.Name) + "/"
+	var entries []transfer.Entry
+	for name, data := range f.files {
+		if rel, ok := strings.CutPrefix(name, dir); ok {
+			entries = append(entries, transfer.Entry{Path: rel, Size: int64(len(data))})
+		}
+	}
+	for _, rel := range f.listed {
+		entries = append(entries, transfer.Entry{Path: rel, Size: -1})
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Path < entries[j].Path })
+	return entries, nil
+}
+
+func (f *fakeTree) Stat(ctx context.Context, job transfer.Job) (transfer.Entry, error) {
+	name := path.Join(job.Location, job.Name)
+	data, ok := f.files[name]
+	if !ok {
+		return transfer.Entry{}, fmt.Errorf("stat %s: %w", name, os.ErrNotExist)
+	}
+	return transfer.Entry{Path: job.Name, Size: int64(len(data))}, nil
+}
+
+func TestMirror(t *testing.T) {
+	cases := []struct {
+		name       string
+		files      []string // under /in/dir
+		listed     []string // listed but missing
+		include    []string
+		exclude    []string
+		marker     bool // the remote waits for a .done marker
+		wantStatus string
+		wantClass  retry.Class // when the mirror fails
+		wantUpload []string
+		children   int // child jobs started, one per selected file
+	}{
+		{"everything", []string{"a.csv", "sub/b.csv", "c.json"}, nil, nil, nil, false,
+			"COMPLETED_AND_UPLOADED", 0, []string{"a.csv", "c.json", "sub/b.csv"}, 3},
+		{"selection", []string{"a.csv", "sub/b.csv", "c.json"}, nil, []string{"*.csv"}, []string{"sub/*"}, false,
+			"COMPLETED_AND_UPLOADED", 0, []string{"a.csv"}, 1},
+		{"nothing selected", []string{"a.csv"}, nil, []string{"*.json"}, nil, false,
+			"COMPLETED_AND_UPLOADED", 0, nil, 0},
+		{"some fail", []string{"a.csv"}, []string{"gone.csv"}, nil, nil, false,
+			"PARTIAL", retry.Transient, []string{"a.csv"}, 2},
+		{"all fail", nil, []string{"gone.csv"}, nil, nil, false,
+			"FAILED", retry.Transient, nil, 1},
+		{"all fail for good", nil, []string{"../escape.csv"}, nil, nil, false,
+			"FAILED", retry.Permanent, nil, 1},
+		{"some not ready", []string{"a.csv", "a.csv.done", "b.csv"}, nil, nil, []string{"*.done"}, true,
+			statusNotReady, retry.Transient, []string{"a.csv"}, 2},
+		{"not ready and failed", []string{"a.csv", "a.csv.done", "b.csv"}, []string{"../escape.csv"}, nil, []string{"*.done"}, true,
+			"PARTIAL", retry.Transient, []string{"a.csv"}, 3},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			files := map[string][]byte{}
+			for _, f := range c.files {
+				files["/in/dir/"+f] = []byte("contents of " + f)
+			}
+			backend := &fakeBackend{dir: t.TempDir(), files: files}
+			r, store, objects := withConsumer(t, backend)
+			r.fetcher = &fakeTree{fakeBackend: backend, listed: c.listed}
+			if c.marker {
+				r.ready = readiness{policy: "marker", markers: []string{".done"}}
+			}
+
+			n := model.DownloadNotification{JobID: "mirror-1", Name: "dir", Location: "/in", Mirror: true, Include: c.include, Exclude: c.exclude, Remote: r.name}
+			j := startJob(context.Background(), n.JobID, "", n, 1)
+			result := processJob(context.Background(), kafka.Message{}, j)
+
+			if result.Status != c.wantStatus {
+				t.Fatalf("status = %s (%v), want %s", result.Status, result.Err, c.wantStatus)
+			}
+			if c.wantStatus != "COMPLETED_AND_UPLOADED" && (result.Err == nil || retry.Classify(result.Err) != c.wantClass) {
+				t.Errorf("err = %v, want a %v error", result.Err, c.wantClass)
+			}
+			var uploaded []string
+			for key := range objects {
+				uploaded = append(uploaded, strings.TrimPrefix(key, "/archive/dir/"))
+			}
+			sort.Strings(uploaded)
+			if !reflect.DeepEqual(uploaded, c.wantUpload) {
+				t.Errorf("uploaded %v, want %v", uploaded, c.wantUpload)
+			}
+			if children := len(store.states) - 1; children != c.children {
+				t.Errorf("%d child jobs, want %d", children, c.children)
+			}
+		})
+	}
+}
@@ -0,0 +1,292 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/Mwambama/KafkaSync/internal/checksum"
+	"github.com/Mwambama/KafkaSync/internal/logging"
+	"github.com/Mwambama/KafkaSync/internal/model"
+	"github.com/Mwambama/KafkaSync/internal/queue"
+	"github.com/Mwambama/KafkaSync/internal/retry"
+	"github.com/Mwambama/KafkaSync/internal/safepath"
+	"github.com/Mwambama/KafkaSync/internal/transfer"
+	"github.com/segmentio/kafka-go"
+)
+
+// jobResult is the terminal outcome of a job, plus whatever transfer
+// metrics were gathered before it ended.
+type jobResult struct {
+	Status string
+	Stage  string // pipeline stage that failed, empty on success
+	Err    error
+
+	Size         int64
+	DownloadTime time.Duration
+	UploadTime   time.Duration
+}
+
+func failed(status, stage string, err error) jobResult {
+	return jobResult{Status: status, Stage: stage, Err: err}
+}
+
+// handleMessage parses and processes one Kafka message. It reports whether
+// the message has been fully dealt with and its offset may be committed.
+func handleMessage(ctx context.Context, message kafka.Message) bool {
+	attempt := queue.Attempts(message) + 1
+	logger := slog.With("topic", message.Topic, "partition", message.Partition, "offset", message.Offset)
+
+	notification, err := queue.Receive(message)
+	if err != nil {
+		logger.Error("Failed to parse JSON message", "error", err)
+		jobsTotal.Inc("PARSE_FAILED")
+		ctx = logging.NewContext(ctx, logger)
+		return deadLetter(ctx, message, jobID(message, notification), failed("", queue.StageParse, err), attempt)
+	}
+
+	// Every line logged for this job, down to the transfer backend, carries
+	// the job ID and where the message came from.
+	id := jobID(message, notification)
+	ctx = logging.NewContext(ctx, logger.With("job_id", id, "remote", remoteName(notification), "file", notification.FileName(), "attempt", attempt))
+
+	j := startJob(ctx, id, "", notification, attempt)
+	result := processJob(ctx, message, j)
+	if result.Err != nil && ctx.Err() != nil {
+		// Shutting down: leave the offset uncommitted so the job is
+		// redelivered, and any partial file in incompletes is resumed.
+		j.log.Warn("Interrupted", "stage", result.Stage)
+		result.Status, result.Err = "INTERRUPTED", ctx.Err()
+		j.finish(result.Status, result.Err)
+		recordDownload(message, j, result)
+		observeJob(result)
+		return false
+	}
+	if result.Status == statusNotReady {
+		timeout := readyTimeout(j.Remote)
+		if since, ok := queue.DeferredSince(message); ok && timeout > 0 && time.Since(since) > timeout {
+			result.Err = retry.MarkPermanent(fmt.Errorf("gave up after %s: %w", time.Since(since).Round(time.Second), result.Err))
+		} else {
+			j.deferred(result.Status, result.Err)
+			recordDownload(message, j, result)
+			observeJob(result)
+			return deferJob(ctx, message, j, result)
+		}
+	}
+	j.finish(result.Status, result.Err)
+	recordDownload(message, j, result)
+	observeJob(result)
+	if result.Err == nil {
+		return true
+	}
+
+	if retry.Classify(result.Err) == retry.Transient && attempt <= len(retryTiers) {
+		return scheduleRetry(ctx, message, j, result)
+	}
+	return deadLetter(ctx, message, j.ID, result, attempt)
+}
+
+// deadLetter publishes a failed message to the dead-letter topic, if one is
+// configured. The publish is retried until it succeeds; it returns false
+// only when ctx ends first, so the job is redelivered rather than lost.
+func deadLetter(ctx context.Context, message kafka.Message, id string, result jobResult, attempt int) bool {
+	if dlqWriter == nil {
+		return true
+	}
+	dead := queue.DeadLetter(message, queue.Failure{
+		JobID:   id,
+		Stage:   result.Stage,
+		Err:     result.Err.Error(),
+		Attempt: attempt,
+	})
+	logger := logging.FromContext(ctx)
+	if !writeUntilDone(ctx, dlqWriter, dead, logger.With("dlq_topic", dlqWriter.Topic), "Failed to publish to dead-letter topic") {
+		return false
+	}
+	logger.Warn("Sent to dead-letter topic", "dlq_topic", dlqWriter.Topic, "stage", result.Stage)
+	return true
+}
+
+// writeUntilDone writes message, backing off between attempts, until it
+// succeeds or ctx ends. Giving up while the consumer runs would leave the
+// offset uncommitted and hold back every later offset on the partition.
+func writeUntilDone(ctx context.Context, w *kafka.Writer, message kafka.Message, logger *slog.Logger, msg string) bool {
+	backoff := time.Second
+	for {
+		err := w.WriteMessages(ctx, message)
+		if err == nil {
+			return true
+		}
+		logger.Error(msg, "error", err, "retry_in", backoff)
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return false
+		}
+		backoff = min(2*backoff, time.Minute)
+	}
+}
+
+// processJob runs one notification through download, verification, move and
+// upload, or hands a mirror job to mirror. Every path through it ends in a
+// terminal status.
+func processJob(ctx context.Context, message kafka.Message, j *job) jobResult {
+	notification := j.Notification
+	j.looks = queue.Looks(message)
+	r, err := remoteFor(notification)
+	if err != nil {
+		j.log.Error("No such remote", "error", err)
+		return failed("UNKNOWN_REMOTE", queue.StageDownload, err)
+	}
+	// The name becomes a path under incompletes and completes and an object
+	// key, so it is checked before anything touches the filesystem.
+	local, err := safepath.Clean(notification.FileName())
+	if err != nil {
+		j.log.Error("Rejected file name", "error", err)
+		return failed("REJECTED_NAME", queue.StageDownload, retry.MarkPermanent(err))
+	}
+	if notification.Mirror {
+		return mirror(ctx, message, j, r, local)
+	}
+	if alreadyArchived(ctx, r, notification, local) {
+		j.log.Info("Already archived, skipping", "hash", notification.Hash)
+		return jobResult{Status: "SKIPPED_DUPLICATE"}
+	}
+
+	return processFile(ctx, j, r, file{
+		Job: transfer.Job{
+			Location:  notification.Location,
+			Name:      notification.FileName(),
+			LocalName: local,
+			Source:    notification.Source,
+		},
+		key: r.objectKey(local),
+	})
+}
+
+// file is one download: what to fetch, staged and moved under
+// Job.LocalName, and the object key it is uploaded to.
+type file struct {
+	transfer.Job
+	key string
+}
+
+// processFile downloads, verifies, moves and uploads one file.
+func processFile(ctx context.Context, j *job, r *remote, f file) jobResult {
+	j.log.Info("Preparing to download", "location", j.Notification.Origin(), "hash", j.Notification.Hash)
+
+	var metrics jobResult
+	fail := func(status, stage string, err error) jobResult {
+		metrics.Status, metrics.Stage, metrics.Err = status, stage, err
+		return metrics
+	}
+
+	marker, err := r.checkReady(ctx, j.looks, f.Job)
+	if errors.Is(err, errNotReady) {
+		j.log.Info("Not ready yet", "reason", err)
+		return fail(statusNotReady, queue.StageDownload, retry.MarkTransient(err))
+	}
+	if err != nil {
+		j.log.Error("Readiness check failed", "error", err)
+		return fail("FAILED", queue.StageDownload, err)
+	}
+
+	j.to(model.StateDownloading)
+	j.log.Debug("Running download")
+	started := time.Now()
+	from, size, err := r.fetch(ctx, f.Job)
+	metrics.DownloadTime = time.Since(started)
+	if errors.Is(err, transfer.ErrUnsafeName) {
+		j.log.Error("Rejected file name", "error", err)
+		return fail("REJECTED_NAME", queue.StageDownload, err)
+	}
+	if errors.Is(err, transfer.ErrSource) {
+		j.log.Error("Remote cannot fetch this source", "error", err)
+		return fail("UNSUPPORTED_SOURCE", queue.StageDownload, err)
+	}
+	if errors.Is(err, transfer.ErrHostKey) {
+		j.log.Error("Host key verification failed", "error", err)
+		return fail("HOST_KEY_MISMATCH", queue.StageDownload, err)
+	}
+	if errors.Is(err, transfer.ErrMissing) {
+		j.log.Error("File not found after download", "path", from)
+		return fail("MISSING", queue.StageDownload, err)
+	}
+	if err != nil {
+		j.log.Error("Download failed", "error", err)
+		return fail("FAILED", queue.StageDownload, err)
+	}
+	metrics.Size = size
+	j.log.Info("Downloaded", "bytes", size, "duration", metrics.DownloadTime.Round(time.Millisecond))
+
+	j.to(model.StateVerifying)
+	if result, ok := verifyHash(j, from); !ok {
+		return fail(result.Status, result.Stage, result.Err)
+	}
+
+	j.to(model.StateMoving)
+	to, err := safepath.Join(r.completes, f.LocalName)
+	if err == nil {
+		err = os.MkdirAll(filepath.Dir(to), 0755)
+	}
+	if err == nil {
+		err = os.Rename(from, to)
+	}
+	if err != nil {
+		j.log.Error("Failed to move to completes", "error", err)
+		return fail("MOVE_FAILED", queue.StageMove, err)
+	}
+	j.log.Info("File moved to completed", "path", to)
+
+	// Upload to Cloud
+	j.to(model.StateUploading)
+	started = time.Now()
+	err = uploadToStorage(ctx, to, f.key)
+	metrics.UploadTime = time.Since(started)
+	if err != nil {
+		j.log.Error("Failed to upload to S3", "error", err)
+		return fail("UPLOAD_FAILED", queue.StageUpload, err)
+	}
+	if marker != "" && r.ready.archiveMarker {
+		if err := archiveMarker(ctx, j, r, f, marker); err != nil {
+			j.log.Error("Failed to archive marker", "error", err)
+			return fail("MARKER_FAILED", queue.StageUpload, err)
+		}
+	}
+	metrics.Status = "COMPLETED_AND_UPLOADED"
+	return metrics
+}
+
+// verifyHash checks the staged file against info_hash. A bad file is deleted
+// from incompletes so the next attempt starts clean instead of resuming it.
+func verifyHash(j *job, path string) (jobResult, bool) {
+	err := checksum.Verify(path, j.Notification.Hash)
+	var mismatch *checksum.MismatchError
+	switch {
+	case err == nil:
+		j.log.Info("Hash verified")
+		return jobResult{}, true
+	case j.Notification.Hash == "":
+		// Files of a mirror job never have one.
+		j.log.Debug("No hash given, skipping verification")
+		return jobResult{}, true
+	case errors.Is(err, checksum.ErrNoAlgorithm):
+		j.log.Warn("Hash has no algorithm prefix, skipping verification", "hash", j.Notification.Hash)
+		return jobResult{}, true
+	case errors.As(err, &mismatch):
+		j.log.Error("Hash mismatch", "error", err)
+		os.Remove(path)
+		return failed("HASH_MISMATCH", queue.StageVerify, retry.MarkPermanent(err)), false
+	case errors.Is(err, os.ErrNotExist), errors.Is(err, os.ErrPermission):
+		j.log.Error("Could not read file for hashing", "path", path, "error", err)
+		return failed("FAILED", queue.StageVerify, err), false
+	default:
+		// Unknown algorithm or malformed digest: the message can never verify.
+		j.log.Error("Cannot verify", "error", err)
+		return failed("HASH_MISMATCH", queue.StageVerify, retry.MarkPermanent(fmt.Errorf("unverifiable hash: %w", err))), false
+	}
+}
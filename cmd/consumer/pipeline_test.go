@@ -0,0 +1,213 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+
+	"github.com/Mwambama/KafkaSync/internal/config"
+	"github.com/Mwambama/KafkaSync/internal/model"
+	"github.com/Mwambama/KafkaSync/internal/retry"
+	"github.com/Mwambama/KafkaSync/internal/transfer"
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+	"github.com/segmentio/kafka-go"
+)
+
+// fakeBackend serves files from memory. For a file it does not have it
+// returns ErrMissing, as the real backends do when a download leaves
+// nothing behind; err, when set, is returned for every fetch.
+type fakeBackend struct {
+	dir   string
+	files map[string][]byte // by Location/Name
+	err   error
+}
+
+func (f *fakeBackend) Fetch(ctx context.Context, job transfer.Job) (string, int64, error) {
+	local := filepath.Join(f.dir, filepath.FromSlash(job.LocalName))
+	if f.err != nil {
+		return "", 0, f.err
+	}
+	data, ok := f.files[path.Join(job.Location, job.Name)]
+	if !ok {
+		return local, 0, fmt.Errorf("%w: %s", transfer.ErrMissing, local)
+	}
+	if err := os.MkdirAll(filepath.Dir(local), 0755); err != nil {
+		return "", 0, err
+	}
+	return local, int64(len(data)), os.WriteFile(local, data, 0644)
+}
+
+// fakeStore keeps the job states and downloads it is told about.
+type fakeStore struct {
+	mu          sync.Mutex
+	states      map[string][]string
+	downloads   []model.Download
+	archived    map[string]string // hash by file name, for Archived
+	archivedErr error
+}
+
+func (s *fakeStore) AddJobEvent(ctx context.Context, id, state string, attempt int, detail string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.states[id] = append(s.states[id], state)
+	return nil
+}
+
+func (s *fakeStore) TrustHostKey(ctx context.Context, host, keyType, fingerprint string) (string, error) {
+	return fingerprint, nil
+}
+func (s *fakeStore) StartJob(context.Context, string, string, string, model.DownloadNotification, int) error {
+	return nil
+}
+func (s *fakeStore) SetJobState(context.Context, string, string, string) error { return nil }
+func (s *fakeStore) RecordDownload(ctx context.Context, d model.Download) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.downloads = append(s.downloads, d)
+	return nil
+}
+func (s *fakeStore) Completed(context.Context, string) (int64, bool, error) { return 0, false, nil }
+func (s *fakeStore) Archived(ctx context.Context, remote, origin, name, hash string) (bool, error) {
+	if s.archivedErr != nil {
+		return false, s.archivedErr
+	}
+	return hash != "" && s.archived[name] == hash, nil
+}
+func (s *fakeStore) Close() error { return nil }
+
+// s3StandIn accepts PutObject and keeps the request bodies by path. HEAD
+// finds what was put, or what a test added to the map.
+func s3StandIn(t *testing.T) (string, map[string][]byte) {
+	var mu sync.Mutex
+	objects := map[string][]byte{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Method == http.MethodHead {
+			mu.Lock()
+			body, ok := objects[req.URL.Path]
+			mu.Unlock()
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			w.Header().Set("ETag", `"d41d8cd98f00b204e9800998ecf8427e"`)
+			w.Header().Set("Last-Modified", "Sat, 01 Mar 2025 12:00:00 GMT")
+			w.Header().Set("Content-Length", fmt.Sprint(len(body)))
+			return
+		}
+		if req.Method != http.MethodPut {
+			http.Error(w, "not implemented", http.StatusNotImplemented)
+			return
+		}
+		body, _ := io.ReadAll(req.Body)
+		mu.Lock()
+		objects[req.URL.Path] = body
+		mu.Unlock()
+		w.Header().Set("ETag", `"d41d8cd98f00b204e9800998ecf8427e"`)
+	}))
+	t.Cleanup(srv.Close)
+	return strings.TrimPrefix(srv.URL, "http://"), objects
+}
+
+// withConsumer points the consumer's globals at backend, a fake store and
+// an S3 stand-in for the length of the test.
+func withConsumer(t *testing.T, backend *fakeBackend) (*remote, *fakeStore, map[string][]byte) {
+	t.Helper()
+	endpoint, objects := s3StandIn(t)
+	client, err := minio.New(endpoint, &minio.Options{
+		Creds:  credentials.NewStaticV4("key", "secret", ""),
+		Region: "us-east-1",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := &fakeStore{states: map[string][]string{}}
+	r := &remote{name: "test", fetcher: backend, incompletes: backend.dir, completes: t.TempDir()}
+
+	oldConf, oldDB, oldClient, oldRemotes := conf, db, minioClient, remotes
+	t.Cleanup(func() { conf, db, minioClient, remotes = oldConf, oldDB, oldClient, oldRemotes })
+	conf = &config.Config{ObjectStorage: config.ObjectStorage{Endpoint: endpoint, Bucket: "archive"}}
+	db, minioClient = store, client
+	remotes = map[string]*remote{r.name: r}
+	return r, store, objects
+}
+
+func TestProcessJob(t *testing.T) {
+	data := []byte("id,amount\n1,100\n")
+	hash := fmt.Sprintf("sha256:%x", sha256.Sum256(data))
+	refused := &net.OpError{Op: "dial", Net: "tcp", Err: os.NewSyscallError("connect", syscall.ECONNREFUSED)}
+
+	cases := []struct {
+		name       string
+		file       string
+		hash       string
+		err        error
+		wantStatus string
+		wantClass  retry.Class // when the job fails
+		wantStates []string
+	}{
+		{"success", "report.csv", hash, nil, "COMPLETED_AND_UPLOADED", 0,
+			[]string{model.StateReceived, model.StateDownloading, model.StateVerifying, model.StateMoving, model.StateUploading}},
+		{"missing after download", "gone.csv", "", nil, "MISSING", retry.Transient,
+			[]string{model.StateReceived, model.StateDownloading}},
+		{"connection refused", "report.csv", hash, refused, "FAILED", retry.Transient,
+			[]string{model.StateReceived, model.StateDownloading}},
+		{"hash mismatch", "report.csv", "sha256:" + strings.Repeat("0", 64), nil, "HASH_MISMATCH", retry.Permanent,
+			[]string{model.StateReceived, model.StateDownloading, model.StateVerifying}},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			backend := &fakeBackend{dir: t.TempDir(), files: map[string][]byte{"/in/report.csv": data}, err: c.err}
+			r, store, objects := withConsumer(t, backend)
+
+			n := model.DownloadNotification{JobID: "job-1", Name: c.file, Location: "/in", Hash: c.hash, Remote: r.name}
+			j := startJob(context.Background(), n.JobID, "", n, 1)
+			result := processJob(context.Background(), kafka.Message{}, j)
+
+			if result.Status != c.wantStatus {
+				t.Fatalf("status = %s (%v), want %s", result.Status, result.Err, c.wantStatus)
+			}
+			if got := store.states[n.JobID]; !reflect.DeepEqual(got, c.wantStates) {
+				t.Errorf("states = %v, want %v", got, c.wantStates)
+			}
+			if c.wantStatus != "COMPLETED_AND_UPLOADED" {
+				if result.Err == nil || retry.Classify(result.Err) != c.wantClass {
+					t.Errorf("err = %v (%v), want a %v error", result.Err, retry.Classify(result.Err), c.wantClass)
+				}
+				if c.err != nil && !errors.Is(result.Err, syscall.ECONNREFUSED) {
+					t.Errorf("err = %v, want the backend's error", result.Err)
+				}
+				if len(objects) != 0 {
+					t.Errorf("uploaded %v for a failed job", reflect.ValueOf(objects).MapKeys())
+				}
+				return
+			}
+
+			if result.Size != int64(len(data)) {
+				t.Errorf("size = %d, want %d", result.Size, len(data))
+			}
+			if got, err := os.ReadFile(filepath.Join(r.completes, "report.csv")); err != nil || !bytes.Equal(got, data) {
+				t.Errorf("completes/report.csv = %q, %v, want the file", got, err)
+			}
+			// The body may be in aws-chunked framing, which wraps it
+			// without changing it.
+			if got, ok := objects["/archive/report.csv"]; !ok || !bytes.Contains(got, data) {
+				t.Errorf("objects = %v, want archive/report.csv with the file", reflect.ValueOf(objects).MapKeys())
+			}
+		})
+	}
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/Mwambama/KafkaSync/internal/config"
+	"github.com/Mwambama/KafkaSync/internal/queue"
+	"github.com/Mwambama/KafkaSync/internal/retry"
+	"github.com/Mwambama/KafkaSync/internal/safepath"
+	"github.com/Mwambama/KafkaSync/internal/transfer"
+)
+
+const (
+	statusNotReady = "NOT_READY"
+
+	defaultStablePolls    = 3
+	defaultStableInterval = 10 * time.Second
+	defaultReadyTimeout   = 24 * time.Hour
+)
+
+// errNotReady means the remote's ready policy says the file is still being
+// written. Such jobs are deferred, not failed.
+var errNotReady = errors.New("file is not ready")
+
+// readiness is a remote's ready policy, parsed.
+type readiness struct {
+	policy        string // "", "stable" or "marker"
+	polls         int
+	interval      time.Duration
+	markers       []string
+	archiveMarker bool
+	timeout       time.Duration
+}
+
+func newReadiness(details config.RemoteDetails) readiness {
+	// Durations were checked by Validate.
+	duration := func(value string, def time.Duration) time.Duration {
+		if d, err := time.ParseDuration(value); err == nil {
+			return d
+		}
+		return def
+	}
+	r := readiness{
+		policy:        strings.ToLower(details.Ready),
+		polls:         details.StablePolls,
+		interval:      duration(details.StableInterval, defaultStableInterval),
+		markers:       details.MarkerSuffixes(),
+		archiveMarker: details.ArchiveMarker,
+		timeout:       duration(details.ReadyTimeout, defaultReadyTimeout),
+	}
+	if r.polls == 0 {
+		r.polls = defaultStablePolls
+	}
+	return r
+}
+
+// checkReady applies the remote's ready policy to a file before it is
+// downloaded. For the marker policy it returns the suffix of the marker
+// that was found. It looks once and never waits: the stable policy counts
+// its looks in looks, which travel with the job while it is deferred.
+func (r *remote) checkReady(ctx context.Context, looks map[string]queue.Look, job transfer.Job) (string, error) {
+	if r.ready.policy == "" {
+		return "", nil
+	}
+	stater, ok := r.fetcher.(transfer.Stater)
+	if !ok {
+		return "", retry.MarkPermanent(fmt.Errorf("%w: the %s backend cannot check whether files are ready", transfer.ErrSource, r.transfer.Backend))
+	}
+
+	if r.ready.policy == "marker" {
+		for _, suffix := range r.ready.markers {
+			_, err := stater.Stat(ctx, markerJob(job, suffix))
+			if err == nil {
+				return suffix, nil
+			}
+			if !errors.Is(err, os.ErrNotExist) {
+				return "", err
+			}
+		}
+		return "", fmt.Errorf("%w: no %s marker yet", errNotReady, strings.Join(r.ready.markers, " or "))
+	}
+
+	// stable: the same size and time on polls looks in a row, at least
+	// interval apart.
+	e, err := stater.Stat(ctx, job)
+	if err != nil {
+		return "", err
+	}
+	if e.Size < 0 && e.ModTime.IsZero() {
+		// Nothing to compare: it would look stable however fast it grew.
+		return "", retry.MarkPermanent(fmt.Errorf("%w: the remote reports neither size nor time for %s, so stability cannot be checked", transfer.ErrSource, e.Path))
+	}
+	now := time.Now()
+	last, seen := looks[job.Name]
+	switch {
+	case !seen:
+		looks[job.Name] = queue.Look{Size: e.Size, ModTime: e.ModTime, Seen: 1, At: now}
+		return "", fmt.Errorf("%w: first look (%d bytes)", errNotReady, e.Size)
+	case e.Size != last.Size || !e.ModTime.Equal(last.ModTime):
+		looks[job.Name] = queue.Look{Size: e.Size, ModTime: e.ModTime, Seen: 1, At: now}
+		return "", fmt.Errorf("%w: still changing (%d bytes, then %d)", errNotReady, last.Size, e.Size)
+	case now.Sub(last.At) >= r.ready.interval:
+		// Sooner than that, the look does not count.
+		last.Seen, last.At = last.Seen+1, now
+		looks[job.Name] = last
+	}
+	if last.Seen < r.ready.polls {
+		return "", fmt.Errorf("%w: unchanged on %d of %d looks", errNotReady, last.Seen, r.ready.polls)
+	}
+	return "", nil
+}
+
+// markerJob is the companion file of job with the given suffix.
+func markerJob(job transfer.Job, suffix string) transfer.Job {
+	marker := transfer.Job{Location: job.Location, Name: job.Name + suffix, LocalName: job.LocalName + suffix}
+	if job.Source != "" {
+		if u, err := url.Parse(job.Source); err == nil {
+			u.Path, u.RawPath = u.Path+suffix, ""
+			marker.Source = u.String()
+		}
+	}
+	return marker
+}
+
+// archiveMarker fetches the marker that made f ready and uploads it next to
+// the file.
+func archiveMarker(ctx context.Context, j *job, r *remote, f file, suffix string) error {
+	marker := markerJob(f.Job, suffix)
+	from, _, err := r.fetch(ctx, marker)
+	if err != nil {
+		return err
+	}
+	to, err := safepath.Join(r.completes, marker.LocalName)
+	if err == nil {
+		err = os.Rename(from, to)
+	}
+	if err != nil {
+		return err
+	}
+	if err := uploadToStorage(ctx, to, f.key+suffix); err != nil {
+		return err
+	}
+	j.log.Info("Marker archived", "marker", marker.LocalName)
+	return nil
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/Mwambama/KafkaSync/internal/queue"
+	"github.com/Mwambama/KafkaSync/internal/retry"
+	"github.com/Mwambama/KafkaSync/internal/transfer"
+)
+
+// fakeStater answers Stat from a map by Location/Name and counts the calls.
+type fakeStater struct {
+	entries map[string]transfer.Entry
+	err     error // returned for names not in entries, instead of not-exist
+	stats   int
+}
+
+func (f *fakeStater) Fetch(ctx context.Context, job transfer.Job) (string, int64, error) {
+	return "", 0, errors.New("not a real backend")
+}
+
+func (f *fakeStater) Stat(ctx context.Context, job transfer.Job) (transfer.Entry, error) {
+	f.stats++
+	name := path.Join(job.Location, job.Name)
+	if e, ok := f.entries[name]; ok {
+		return e, nil
+	}
+	if f.err != nil {
+		return transfer.Entry{}, f.err
+	}
+	return transfer.Entry{}, fmt.Errorf("stat %s: %w", name, os.ErrNotExist)
+}
+
+func TestCheckReadyStable(t *testing.T) {
+	mtime := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	now := time.Now()
+	job := transfer.Job{Location: "/in", Name: "report.csv"}
+	look := func(size int64, seen int, ago time.Duration) map[string]queue.Look {
+		return map[string]queue.Look{job.Name: {Size: size, ModTime: mtime, Seen: seen, At: now.Add(-ago)}}
+	}
+
+	cases := []struct {
+		name      string
+		entry     transfer.Entry
+		looks     map[string]queue.Look
+		wantReady bool
+		wantSeen  int // recorded for the file afterwards
+	}{
+		{"first look", transfer.Entry{Size: 100, ModTime: mtime}, map[string]queue.Look{}, false, 1},
+		{"grew since", transfer.Entry{Size: 150, ModTime: mtime}, look(100, 2, time.Minute), false, 1},
+		{"touched since", transfer.Entry{Size: 100, ModTime: mtime.Add(time.Second)}, look(100, 2, time.Minute), false, 1},
+		{"unchanged, not enough looks", transfer.Entry{Size: 100, ModTime: mtime}, look(100, 1, time.Minute), false, 2},
+		{"unchanged, too soon to count", transfer.Entry{Size: 100, ModTime: mtime}, look(100, 2, time.Second), false, 2},
+		{"unchanged on the last look", transfer.Entry{Size: 100, ModTime: mtime}, look(100, 2, time.Minute), true, 3},
+		{"size only", transfer.Entry{Size: 100}, map[string]queue.Look{job.Name: {Size: 100, Seen: 2, At: now.Add(-time.Minute)}}, true, 3},
+		{"another file's looks", transfer.Entry{Size: 100, ModTime: mtime}, map[string]queue.Look{"other.csv": {Size: 100, ModTime: mtime, Seen: 2}}, false, 1},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			stater := &fakeStater{entries: map[string]transfer.Entry{"/in/report.csv": c.entry}}
+			r := &remote{fetcher: stater, ready: readiness{policy: "stable", polls: 3, interval: 10 * time.Second}}
+
+			_, err := r.checkReady(context.Background(), c.looks, job)
+			if c.wantReady && err != nil {
+				t.Errorf("checkReady = %v, want ready", err)
+			}
+			if !c.wantReady && !errors.Is(err, errNotReady) {
+				t.Errorf("checkReady = %v, want errNotReady", err)
+			}
+			if stater.stats != 1 {
+				t.Errorf("%d Stat calls, want one look per attempt", stater.stats)
+			}
+			if got := c.looks[job.Name]; got.Seen != c.wantSeen || got.Size != c.entry.Size || !got.ModTime.Equal(c.entry.ModTime) {
+				t.Errorf("look = %+v, want %d bytes at %v seen %d times", got, c.entry.Size, c.entry.ModTime, c.wantSeen)
+			}
+		})
+	}
+
+	// Without size or time there is nothing to compare.
+	r := &remote{fetcher: &fakeStater{entries: map[string]transfer.Entry{"/in/report.csv": {Size: -1}}}, ready: readiness{policy: "stable", polls: 3}}
+	if _, err := r.checkReady(context.Background(), map[string]queue.Look{}, job); !errors.Is(err, transfer.ErrSource) || retry.Classify(err) != retry.Permanent {
+		t.Errorf("no size or time: err = %v, want a permanent ErrSource", err)
+	}
+}
+
+func TestCheckReadyMarker(t *testing.T) {
+	job := transfer.Job{Location: "/in", Name: "report.csv"}
+	broken := errors.New("connection reset")
+
+	cases := []struct {
+		name       string
+		files      []string
+		err        error
+		wantMarker string
+		wantErr    error // nil when ready
+	}{
+		{"first marker", []string{"report.csv", "report.csv.done"}, nil, ".done", nil},
+		{"second marker", []string{"report.csv", "report.csv.ok"}, nil, ".ok", nil},
+		{"both", []string{"report.csv.ok", "report.csv.done"}, nil, ".done", nil},
+		{"no marker yet", []string{"report.csv"}, nil, "", errNotReady},
+		{"another file's marker", []string{"report.csv", "other.csv.done"}, nil, "", errNotReady},
+		{"stat fails", []string{"report.csv"}, broken, "", broken},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			stater := &fakeStater{entries: map[string]transfer.Entry{}, err: c.err}
+			for _, f := range c.files {
+				stater.entries[path.Join("/in", f)] = transfer.Entry{Path: f, Size: 1}
+			}
+			r := &remote{fetcher: stater, ready: readiness{policy: "marker", markers: []string{".done", ".ok"}}}
+
+			marker, err := r.checkReady(context.Background(), map[string]queue.Look{}, job)
+			if marker != c.wantMarker || !errors.Is(err, c.wantErr) || (c.wantErr == nil && err != nil) {
+				t.Errorf("checkReady = %q, %v; want %q, %v", marker, err, c.wantMarker, c.wantErr)
+			}
+		})
+	}
+
+	// A backend that cannot stat cannot check.
+	r := &remote{fetcher: &fakeBackend{}, ready: readiness{policy: "marker", markers: []string{".done"}}}
+	if _, err := r.checkReady(context.Background(), map[string]queue.Look{}, job); !errors.Is(err, transfer.ErrSource) {
+		t.Errorf("backend without Stat: err = %v, want ErrSource", err)
+	}
+}
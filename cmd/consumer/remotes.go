@@ -0,0 +1,151 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"path"
+	"path/filepath"
+	"sort"
+
+	"github.com/Mwambama/KafkaSync/internal/config"
+	"github.com/Mwambama/KafkaSync/internal/logging"
+	"github.com/Mwambama/KafkaSync/internal/model"
+	"github.com/Mwambama/KafkaSync/internal/retry"
+	"github.com/Mwambama/KafkaSync/internal/transfer"
+)
+
+// remote is one configured server with its own backend, directories and
+// concurrency cap.
+type remote struct {
+	name        string
+	transfer    transfer.Remote
+	fetcher     transfer.Transferer
+	incompletes string
+	completes   string
+	subpath     string        // prefix for object keys, may be empty
+	slots       chan struct{} // nil when concurrent_jobs is 0 (no cap)
+	ready       readiness
+}
+
+var remotes map[string]*remote
+
+// initRemotes builds a transfer backend and staging directories for every
+// remote. It runs after initDB: trust-on-first-use keeps host keys in the
+// database.
+func initRemotes() {
+	all := conf.AllRemotes()
+	names := make([]string, 0, len(all))
+	for name := range all {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	remotes = make(map[string]*remote, len(all))
+	for _, name := range names {
+		details := all[name]
+		r := &remote{
+			name:        name,
+			incompletes: filepath.Join(conf.Locations.Incompletes, details.Subpath),
+			completes:   filepath.Join(conf.Locations.Completes, details.Subpath),
+			subpath:     filepath.ToSlash(details.Subpath),
+			ready:       newReadiness(details),
+		}
+		if details.ConcurrentJobs > 0 {
+			r.slots = make(chan struct{}, details.ConcurrentJobs)
+		}
+		for _, dir := range []string{r.incompletes, r.completes} {
+			if err := ensureDir(dir); err != nil {
+				logging.Fatal("Failed to create directory", "remote", name, "path", dir, "error", err)
+			}
+		}
+
+		var err error
+		r.transfer = transferRemote(details, r.incompletes)
+		r.fetcher, err = transfer.New(r.transfer)
+		if err != nil {
+			logging.Fatal("Failed to set up transfer backend", "remote", name, "error", err)
+		}
+		remotes[name] = r
+		slog.Info("Remote ready", "remote", name, "host", details.Host, "concurrent_jobs", details.ConcurrentJobs)
+	}
+}
+
+func transferRemote(details config.RemoteDetails, dir string) transfer.Remote {
+	return transfer.Remote{
+		Backend:  details.Backend,
+		Host:     details.Host,
+		Username: details.Username,
+		Password: details.Password,
+		Segments: conf.NumThreads,
+		Dir:      dir,
+		Verbose:  slog.Default().Enabled(context.Background(), slog.LevelDebug),
+		Root:     details.Root,
+		UseSSL:   details.UseSSL,
+		Region:   details.Region,
+
+		PrivateKey:    details.PrivateKey,
+		Passphrase:    details.Passphrase,
+		AgentSocket:   details.AgentSocket,
+		KnownHosts:    details.KnownHosts,
+		HostKey:       details.HostKey,
+		HostKeyPolicy: details.HostKeyPolicy,
+		HostKeys:      db,
+	}
+}
+
+// remoteName is the remote a notification asks for, or the default. A
+// message with only a source URI goes to the default remote if that can
+// fetch it, otherwise to the one remote that can; if none or several can,
+// the default remote reports why.
+func remoteName(notification model.DownloadNotification) string {
+	if notification.Remote != "" {
+		return notification.Remote
+	}
+	def := conf.DefaultRemoteName()
+	if notification.Source == "" {
+		return def
+	}
+	if r, ok := remotes[def]; ok && transfer.Serves(r.transfer, notification.Source) {
+		return def
+	}
+	var match []string
+	for name, r := range remotes {
+		if transfer.Serves(r.transfer, notification.Source) {
+			match = append(match, name)
+		}
+	}
+	if len(match) == 1 {
+		return match[0]
+	}
+	return def
+}
+
+// remoteFor looks up the notification's remote. An unknown name can never
+// succeed, so the error is permanent.
+func remoteFor(notification model.DownloadNotification) (*remote, error) {
+	name := remoteName(notification)
+	if r, ok := remotes[name]; ok {
+		return r, nil
+	}
+	return nil, retry.MarkPermanent(fmt.Errorf("unknown remote %q", name))
+}
+
+// objectKey is where a file from r is stored in the bucket.
+func (r *remote) objectKey(name string) string {
+	return path.Join(r.subpath, name)
+}
+
+// fetch downloads through the remote's backend, waiting for one of its
+// slots first when it has a concurrency cap.
+func (r *remote) fetch(ctx context.Context, job transfer.Job) (string, int64, error) {
+	if r.slots != nil {
+		select {
+		case r.slots <- struct{}{}:
+			defer func() { <-r.slots }()
+		case <-ctx.Done():
+			return "", 0, ctx.Err()
+		}
+	}
+	return r.fetcher.Fetch(ctx, job)
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/Mwambama/KafkaSync/internal/logging"
+	"github.com/Mwambama/KafkaSync/internal/queue"
+	"github.com/segmentio/kafka-go"
+)
+
+type retryTier struct {
+	name  string
+	delay time.Duration
+	topic string
+}
+
+var retryTiers []retryTier
+var retryWriter *kafka.Writer // nil when retries are disabled
+var retryWG sync.WaitGroup
+
+var validTopic = regexp.MustCompile(`^[a-zA-Z0-9._-]+$`)
+
+// initRetry parses the tiers and starts one forwarder per delay topic; they
+// stop when ctx is cancelled.
+func initRetry(ctx context.Context) {
+	prefix := conf.Retry.TopicPrefix
+	if prefix == "" {
+		prefix = queue.MainTopic + "-retry-"
+	}
+	for _, name := range conf.Retry.Tiers {
+		delay, err := time.ParseDuration(name)
+		if err != nil || delay <= 0 {
+			logging.Fatal("Invalid retry tier: want a positive duration like \"30s\"", "tier", name)
+		}
+		topic := queue.RetryTopic(prefix, name)
+		if !validTopic.MatchString(topic) {
+			logging.Fatal("Invalid retry topic name", "topic", topic)
+		}
+		retryTiers = append(retryTiers, retryTier{name: name, delay: delay, topic: topic})
+	}
+	if len(retryTiers) == 0 {
+		return
+	}
+
+	// Topic is set per message, one writer serves every tier plus the
+	// forward back onto the main topic.
+	retryWriter = &kafka.Writer{
+		Addr:                   kafka.TCP(conf.KafkaUrl),
+		Balancer:               &kafka.Hash{},
+		RequiredAcks:           kafka.RequireAll,
+		AllowAutoTopicCreation: true,
+	}
+	for _, tier := range retryTiers {
+		retryWG.Add(1)
+		go func() {
+			defer retryWG.Done()
+			runRetryTier(ctx, tier)
+		}()
+	}
+	slog.Info("Retry tiers", "tiers", conf.Retry.Tiers)
+}
+
+// scheduleRetry parks a failed job on the delay topic for its attempt. Like
+// deadLetter, it keeps trying until the publish succeeds or ctx ends.
+func scheduleRetry(ctx context.Context, message kafka.Message, j *job, result jobResult) bool {
+	tier := retryTiers[j.Attempt-1]
+	message.Headers = queue.SetLooks(message.Headers, j.looks)
+	delayed := queue.Retry(message, tier.topic, queue.Failure{
+		JobID:   j.ID,
+		Stage:   result.Stage,
+		Err:     result.Err.Error(),
+		Attempt: j.Attempt,
+	}, time.Now().Add(tier.delay))
+
+	if !writeUntilDone(ctx, retryWriter, delayed, j.log.With("retry_topic", tier.topic), "Failed to schedule retry") {
+		return false
+	}
+	j.log.Warn("Attempt failed, retrying", "error", result.Err, "delay", tier.name)
+	return true
+}
+
+// deferJob parks a job whose file is not ready on the shortest delay topic
+// without using up an attempt. Validate insists on retry tiers when a remote
+// has a ready policy. Like deadLetter, it keeps trying until the publish
+// succeeds or ctx ends.
+func deferJob(ctx context.Context, message kafka.Message, j *job, result jobResult) bool {
+	if len(retryTiers) == 0 {
+		return deadLetter(ctx, message, j.ID, result, j.Attempt)
+	}
+	tier := retryTiers[0]
+	message.Headers = queue.SetLooks(message.Headers, j.looks)
+	delayed := queue.Defer(message, tier.topic, queue.Failure{
+		JobID:   j.ID,
+		Stage:   result.Stage,
+		Err:     result.Err.Error(),
+		Attempt: j.Attempt - 1,
+	}, time.Now().Add(tier.delay))
+
+	if !writeUntilDone(ctx, retryWriter, delayed, j.log.With("retry_topic", tier.topic), "Failed to defer job") {
+		return false
+	}
+	j.log.Info("Deferred until the file is ready", "delay", tier.name)
+	return true
+}
+
+// readyTimeout is how long jobs for the named remote are deferred before
+// they fail; 0 defers them for ever.
+func readyTimeout(name string) time.Duration {
+	if r, ok := remotes[name]; ok {
+		return r.ready.timeout
+	}
+	return defaultReadyTimeout
+}
+
+// runRetryTier holds messages from one delay topic until they are due and
+// then forwards them to the main topic. Every message on a tier has the same
+// delay, so waiting on the head of the partition never delays a later one.
+func runRetryTier(ctx context.Context, tier retryTier) {
+	reader := kafka.NewReader(kafka.ReaderConfig{
+		Brokers:  []string{conf.KafkaUrl},
+		Topic:    tier.topic,
+		GroupID:  "file-consumer-group-retry-" + tier.name, // one per topic, so tiers don't rebalance each other
+		MinBytes: 1,
+		MaxBytes: 10e6,
+	})
+	defer reader.Close()
+	logger := slog.With("retry_topic", tier.topic)
+
+	for {
+		message, err := reader.FetchMessage(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			logger.Error("Error reading retry topic", "error", err)
+			continue
+		}
+
+		if at, ok := queue.RetryAt(message); ok {
+			select {
+			case <-time.After(time.Until(at)):
+			case <-ctx.Done():
+				return
+			}
+		}
+
+		forward := queue.Forward(message)
+		forward.Topic = queue.MainTopic
+		for {
+			err := retryWriter.WriteMessages(ctx, forward)
+			if err == nil {
+				break
+			}
+			logger.Error("Failed to forward retry", "partition", message.Partition, "offset", message.Offset, "error", err)
+			select {
+			case <-time.After(5 * time.Second):
+			case <-ctx.Done():
+				return
+			}
+		}
+		if err := reader.CommitMessages(ctx, message); err != nil {
+			logger.Warn("Failed to commit retry offset", "partition", message.Partition, "offset", message.Offset, "error", err)
+		}
+	}
+}
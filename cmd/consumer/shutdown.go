@@ -0,0 +1,67 @@
+package main
+
+import (
+	"log/slog"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+const defaultShutdownGrace = 30 * time.Second
+
+func shutdownGrace() time.Duration {
+	if conf.ShutdownGrace == "" {
+		return defaultShutdownGrace
+	}
+	grace, err := time.ParseDuration(conf.ShutdownGrace)
+	if err != nil || grace < 0 {
+		slog.Warn("Invalid shutdown_grace, using default", "shutdown_grace", conf.ShutdownGrace, "default", defaultShutdownGrace)
+		return defaultShutdownGrace
+	}
+	return grace
+}
+
+// drain waits for in-flight jobs. Jobs still queued are not started: they
+// stay uncommitted and Kafka redelivers them. Once grace runs out it cancels
+// the running ones, which stops lftp or the native transfer and leaves
+// resumable partials behind, and then waits for them to record INTERRUPTED.
+func drain(pool *workerPool, grace time.Duration, cancelJobs func()) {
+	pool.Stop()
+	done := make(chan struct{})
+	go func() {
+		pool.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		slog.Info("All in-flight jobs finished")
+		return
+	case <-time.After(grace):
+	}
+
+	slog.Warn("Grace period over, cancelling in-flight transfers")
+	cancelJobs()
+	<-done
+}
+
+// shutdown closes everything the consumer holds open. Closing the reader
+// leaves the consumer group, so the partitions are rebalanced right away.
+func shutdown(reader *kafka.Reader) {
+	if err := reader.Close(); err != nil {
+		slog.Warn("Failed to close Kafka reader", "error", err)
+	}
+	for _, w := range []*kafka.Writer{dlqWriter, retryWriter} {
+		if w == nil {
+			continue
+		}
+		if err := w.Close(); err != nil {
+			slog.Warn("Failed to flush Kafka writer", "error", err)
+		}
+	}
+	if err := db.Close(); err != nil {
+		slog.Warn("Failed to close database", "error", err)
+	}
+	s3Transport.CloseIdleConnections()
+	slog.Info("Consumer stopped")
+}
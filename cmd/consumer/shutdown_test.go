@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Mwambama/KafkaSync/internal/model"
+	"github.com/Mwambama/KafkaSync/internal/transfer"
+	"github.com/segmentio/kafka-go"
+)
+
+// stallingBackend starts every download and then waits for its context,
+// like a transfer from a server that has stopped sending.
+type stallingBackend struct {
+	started chan string
+}
+
+func (s *stallingBackend) Fetch(ctx context.Context, job transfer.Job) (string, int64, error) {
+	s.started <- job.Name
+	<-ctx.Done()
+	return "", 0, ctx.Err()
+}
+
+func notificationMessage(t *testing.T, n model.DownloadNotification, offset int64) kafka.Message {
+	t.Helper()
+	value, err := json.Marshal(n)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return kafka.Message{Topic: "downloads", Key: []byte(n.FileName()), Value: value, Offset: offset}
+}
+
+func TestDrain(t *testing.T) {
+	t.Run("jobs finish within the grace period", func(t *testing.T) {
+		pool := newWorkerPool(2, func(kafka.Message) { time.Sleep(10 * time.Millisecond) })
+		pool.Submit(context.Background(), keyed("a", 0))
+		pool.Submit(context.Background(), keyed("b", 1))
+
+		cancelled := false
+		drain(pool, time.Minute, func() { cancelled = true })
+		if cancelled {
+			t.Error("drain cancelled jobs that finished in time")
+		}
+	})
+
+	t.Run("stalled jobs are cancelled after the grace period", func(t *testing.T) {
+		r, store, _ := withConsumer(t, &fakeBackend{dir: t.TempDir()})
+		backend := &stallingBackend{started: make(chan string, 10)}
+		r.fetcher = backend
+
+		jobCtx, cancelJobs := context.WithCancel(context.Background())
+		defer cancelJobs()
+		var mu sync.Mutex
+		var committed []int64
+		pool := newWorkerPool(1, func(message kafka.Message) {
+			if handleMessage(jobCtx, message) {
+				mu.Lock()
+				committed = append(committed, message.Offset)
+				mu.Unlock()
+			}
+		})
+		// Whichever job takes the one slot stalls; the other waits for it
+		// and must never start.
+		for i, name := range []string{"a.csv", "b.csv"} {
+			n := model.DownloadNotification{JobID: name, Name: name, Location: "/in", Remote: r.name}
+			pool.Submit(context.Background(), notificationMessage(t, n, int64(i)))
+		}
+		var stalled string
+		select {
+		case stalled = <-backend.started:
+		case <-time.After(5 * time.Second):
+			t.Fatal("no job started downloading")
+		}
+
+		const grace = 100 * time.Millisecond
+		var cancelledAfter time.Duration
+		started := time.Now()
+		drain(pool, grace, func() {
+			cancelledAfter = time.Since(started)
+			cancelJobs()
+		})
+
+		if cancelledAfter < grace {
+			t.Errorf("cancelled after %v, want the %v grace period first", cancelledAfter, grace)
+		}
+		if len(backend.started) != 0 {
+			t.Errorf("%d queued jobs started downloading during shutdown", len(backend.started))
+		}
+		if len(store.downloads) != 1 || store.downloads[0].JobID != stalled || store.downloads[0].Status != "INTERRUPTED" {
+			t.Errorf("recorded %+v, want only %s as INTERRUPTED", store.downloads, stalled)
+		}
+		if len(committed) != 0 {
+			t.Errorf("committed offsets %v, want none so both jobs are redelivered", committed)
+		}
+	})
+}
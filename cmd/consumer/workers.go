@@ -0,0 +1,151 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+
+	"github.com/Mwambama/KafkaSync/internal/queue"
+	"github.com/segmentio/kafka-go"
+)
+
+// workerPool runs up to `concurrent_jobs` jobs at once while keeping jobs
+// with the same key strictly sequential, so one file is never downloaded
+// by two workers at the same time.
+type workerPool struct {
+	handle  func(kafka.Message)
+	running chan struct{} // one token per job currently being processed
+	queued  chan struct{} // one token per accepted job, bounds what we buffer
+
+	mu       sync.Mutex
+	keys     map[string][]kafka.Message // keys with a job in flight, and their backlog
+	wg       sync.WaitGroup
+	stopping chan struct{} // closed by Stop
+	stopOnce sync.Once
+}
+
+func newWorkerPool(size int, handle func(kafka.Message)) *workerPool {
+	if size < 1 {
+		size = 1
+	}
+	return &workerPool{
+		handle:   handle,
+		running:  make(chan struct{}, size),
+		queued:   make(chan struct{}, size*4),
+		keys:     make(map[string][]kafka.Message),
+		stopping: make(chan struct{}),
+	}
+}
+
+// Submit hands msg to the pool. It blocks while the pool is full, which
+// stops the fetch loop from reading further ahead than we can work.
+func (p *workerPool) Submit(ctx context.Context, msg kafka.Message) error {
+	select {
+	case p.queued <- struct{}{}:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	key := jobKey(msg)
+	p.mu.Lock()
+	if backlog, busy := p.keys[key]; busy {
+		p.keys[key] = append(backlog, msg)
+		p.mu.Unlock()
+		return nil
+	}
+	p.keys[key] = nil
+	p.mu.Unlock()
+
+	p.wg.Add(1)
+	go p.run(key, msg)
+	return nil
+}
+
+// run works through every job for key, in the order they were submitted.
+// Once the pool is stopping it starts no more of them.
+func (p *workerPool) run(key string, msg kafka.Message) {
+	defer p.wg.Done()
+	for {
+		if !p.acquire() {
+			p.drop(key, 1)
+			return
+		}
+		p.handle(msg)
+		<-p.running
+		<-p.queued
+
+		p.mu.Lock()
+		backlog := p.keys[key]
+		if len(backlog) == 0 {
+			delete(p.keys, key)
+			p.mu.Unlock()
+			return
+		}
+		if p.stopped() {
+			p.mu.Unlock()
+			p.drop(key, 0)
+			return
+		}
+		msg, p.keys[key] = backlog[0], backlog[1:]
+		p.mu.Unlock()
+	}
+}
+
+// acquire takes a running slot, or reports false if the pool stops first.
+func (p *workerPool) acquire() bool {
+	select {
+	case p.running <- struct{}{}:
+	case <-p.stopping:
+		return false
+	}
+	if p.stopped() {
+		// Both were ready and select picked the slot.
+		<-p.running
+		return false
+	}
+	return true
+}
+
+// drop forgets key with its backlog and the unstarted jobs run was holding.
+// Their offsets are never committed, so Kafka redelivers them.
+func (p *workerPool) drop(key string, unstarted int) {
+	p.mu.Lock()
+	left := len(p.keys[key]) + unstarted
+	delete(p.keys, key)
+	p.mu.Unlock()
+	for range left {
+		<-p.queued
+	}
+	slog.Debug("Left for redelivery", "key", key, "jobs", left)
+}
+
+// Stop keeps queued jobs from starting; jobs already running carry on.
+func (p *workerPool) Stop() {
+	p.stopOnce.Do(func() { close(p.stopping) })
+}
+
+func (p *workerPool) stopped() bool {
+	select {
+	case <-p.stopping:
+		return true
+	default:
+		return false
+	}
+}
+
+// Wait blocks until every submitted job has finished or been dropped by Stop.
+func (p *workerPool) Wait() {
+	p.wg.Wait()
+}
+
+// jobKey is the Kafka message key (the producer uses the file name). Keyless
+// messages fall back to the name in the payload.
+func jobKey(msg kafka.Message) string {
+	if len(msg.Key) > 0 {
+		return string(msg.Key)
+	}
+	if notification, err := queue.Receive(msg); err == nil {
+		return notification.FileName()
+	}
+	return ""
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// holdingHandler records the jobs it is given and keeps each one running
+// until release is closed.
+type holdingHandler struct {
+	mu         sync.Mutex
+	active     map[string]int     // running jobs by key
+	order      map[string][]int64 // offsets handled, by key
+	running    int
+	maxRunning int
+	overlap    bool // two jobs for one key ran at once
+
+	started chan kafka.Message
+	release chan struct{}
+}
+
+func newHoldingHandler() *holdingHandler {
+	return &holdingHandler{
+		active:  map[string]int{},
+		order:   map[string][]int64{},
+		started: make(chan kafka.Message, 100),
+		release: make(chan struct{}),
+	}
+}
+
+func (h *holdingHandler) handle(msg kafka.Message) {
+	key := string(msg.Key)
+	h.mu.Lock()
+	if h.active[key] > 0 {
+		h.overlap = true
+	}
+	h.active[key]++
+	h.running++
+	h.maxRunning = max(h.maxRunning, h.running)
+	h.order[key] = append(h.order[key], msg.Offset)
+	h.mu.Unlock()
+
+	h.started <- msg
+	<-h.release
+
+	h.mu.Lock()
+	h.active[key]--
+	h.running--
+	h.mu.Unlock()
+}
+
+// waitStarted returns the next n jobs to start, failing the test if they
+// take too long.
+func (h *holdingHandler) waitStarted(t *testing.T, n int) []kafka.Message {
+	t.Helper()
+	var got []kafka.Message
+	for range n {
+		select {
+		case msg := <-h.started:
+			got = append(got, msg)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("%d of %d jobs started", len(got), n)
+		}
+	}
+	return got
+}
+
+func (h *holdingHandler) noneStarted(t *testing.T) {
+	t.Helper()
+	select {
+	case msg := <-h.started:
+		t.Fatalf("job %s@%d started, want it held back", msg.Key, msg.Offset)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func keyed(key string, offset int64) kafka.Message {
+	return kafka.Message{Key: []byte(key), Offset: offset}
+}
+
+func TestWorkerPoolKeys(t *testing.T) {
+	h := newHoldingHandler()
+	pool := newWorkerPool(3, h.handle)
+	submitted := []kafka.Message{
+		keyed("a", 0), keyed("a", 1), keyed("b", 2), keyed("a", 3),
+		keyed("c", 4), keyed("b", 5), keyed("d", 6), keyed("c", 7),
+	}
+	for _, msg := range submitted {
+		if err := pool.Submit(context.Background(), msg); err != nil {
+			t.Fatalf("Submit: %v", err)
+		}
+	}
+
+	// Three jobs start, each for a different key; the rest wait for a slot
+	// or behind their key.
+	first := h.waitStarted(t, 3)
+	keys := map[string]bool{}
+	for _, msg := range first {
+		keys[string(msg.Key)] = true
+	}
+	if len(keys) != 3 {
+		t.Errorf("first jobs = %v, want three different keys", first)
+	}
+	h.noneStarted(t)
+
+	close(h.release)
+	pool.Wait()
+
+	want := map[string][]int64{"a": {0, 1, 3}, "b": {2, 5}, "c": {4, 7}, "d": {6}}
+	if !reflect.DeepEqual(h.order, want) {
+		t.Errorf("handled %v, want %v", h.order, want)
+	}
+	if h.overlap {
+		t.Error("two jobs for one key ran at the same time")
+	}
+	if h.maxRunning != 3 {
+		t.Errorf("%d jobs ran at once, want 3", h.maxRunning)
+	}
+	if len(pool.keys) != 0 || len(pool.running) != 0 || len(pool.queued) != 0 {
+		t.Errorf("pool not empty after Wait: %d keys, %d running, %d queued", len(pool.keys), len(pool.running), len(pool.queued))
+	}
+}
+
+// Submit blocks once the pool holds four jobs per worker, running or not.
+func TestWorkerPoolQueued(t *testing.T) {
+	h := newHoldingHandler()
+	pool := newWorkerPool(2, h.handle)
+	for i := range 8 {
+		if err := pool.Submit(context.Background(), keyed(string(rune('a'+i%3)), int64(i))); err != nil {
+			t.Fatalf("Submit %d: %v", i, err)
+		}
+	}
+	h.waitStarted(t, 2)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := pool.Submit(ctx, keyed("z", 8)); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Submit on a full pool = %v, want it to block until ctx ends", err)
+	}
+
+	close(h.release)
+	pool.Wait()
+	handled := 0
+	for _, offsets := range h.order {
+		handled += len(offsets)
+	}
+	if handled != 8 || len(h.order["z"]) != 0 {
+		t.Errorf("handled %v, want the 8 accepted jobs", h.order)
+	}
+}
+
+// After Stop nothing new starts, running jobs finish, and the pool lets go
+// of everything it held so Wait returns.
+func TestWorkerPoolStop(t *testing.T) {
+	h := newHoldingHandler()
+	pool := newWorkerPool(1, h.handle)
+	for _, msg := range []kafka.Message{keyed("a", 0), keyed("a", 1), keyed("b", 2), keyed("c", 3)} {
+		pool.Submit(context.Background(), msg)
+	}
+	running := h.waitStarted(t, 1)[0]
+
+	pool.Stop()
+	pool.Stop() // twice is fine
+	close(h.release)
+	pool.Wait()
+
+	if len(h.started) != 0 {
+		t.Errorf("%d queued jobs started after Stop", len(h.started))
+	}
+	if want := map[string][]int64{string(running.Key): {running.Offset}}; !reflect.DeepEqual(h.order, want) {
+		t.Errorf("handled %v, want only %v", h.order, want)
+	}
+	if len(pool.keys) != 0 || len(pool.running) != 0 || len(pool.queued) != 0 {
+		t.Errorf("pool not empty after Wait: %d keys, %d running, %d queued", len(pool.keys), len(pool.running), len(pool.queued))
+	}
+}
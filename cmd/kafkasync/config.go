@@ -0,0 +1,22 @@
+package main
+
+import (
+	"log"
+	"os"
+
+	"github.com/BurntSushi/toml"
+)
+
+// runConfig handles `kafkasync config print`: the config the binaries would
+// run with, after KAFKASYNC_* overrides, with secrets redacted.
+func runConfig(args []string) {
+	if len(args) != 1 || args[0] != "print" {
+		usage()
+	}
+	if err := toml.NewEncoder(os.Stdout).Encode(conf.Redacted()); err != nil {
+		log.Fatalf("Failed to print config: %v", err)
+	}
+	if err := conf.Validate(0); err != nil {
+		log.Print(err)
+	}
+}
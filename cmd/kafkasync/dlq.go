@@ -0,0 +1,217 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/Mwambama/KafkaSync/internal/queue"
+	"github.com/segmentio/kafka-go"
+)
+
+func runDLQ(args []string) {
+	if len(args) < 1 {
+		usage()
+	}
+	if conf.DeadLetter.Topic == "" {
+		log.Fatalf("No dead-letter topic configured ([deadLetter] topic in config.toml)")
+	}
+
+	switch args[0] {
+	case "list":
+		dlqList(args[1:])
+	case "redrive":
+		dlqRedrive(args[1:])
+	default:
+		usage()
+	}
+}
+
+func dlqList(args []string) {
+	fs := flag.NewFlagSet("dlq list", flag.ExitOnError)
+	stage := fs.String("stage", "", "only show messages that failed at this stage")
+	fs.Parse(args)
+
+	msgs, err := readAll(conf.DeadLetter.Topic)
+	if err != nil {
+		log.Fatalf("Failed to read %s: %v", conf.DeadLetter.Topic, err)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tSOURCE\tSTAGE\tATTEMPTS\tFAILED AT\tERROR\tPAYLOAD")
+	for _, m := range msgs {
+		if *stage != "" && queue.Header(m, queue.HeaderStage) != *stage {
+			continue
+		}
+		fmt.Fprintf(w, "%d:%d\t%s/%s@%s\t%s\t%s\t%s\t%s\t%s\n",
+			m.Partition, m.Offset,
+			queue.Header(m, queue.HeaderSourceTopic),
+			queue.Header(m, queue.HeaderSourcePartition),
+			queue.Header(m, queue.HeaderSourceOffset),
+			queue.Header(m, queue.HeaderStage),
+			queue.Header(m, queue.HeaderAttempts),
+			queue.Header(m, queue.HeaderFailedAt),
+			queue.Header(m, queue.HeaderError),
+			m.Value,
+		)
+	}
+	w.Flush()
+}
+
+func dlqRedrive(args []string) {
+	fs := flag.NewFlagSet("dlq redrive", flag.ExitOnError)
+	all := fs.Bool("all", false, "re-drive every message on the dead-letter topic")
+	offsets := fs.String("offsets", "", "comma-separated partition:offset IDs from `dlq list`")
+	stage := fs.String("stage", "", "only re-drive messages that failed at this stage")
+	dryRun := fs.Bool("dry-run", false, "show what would be re-driven without publishing")
+	fs.Parse(args)
+
+	if *all == (*offsets != "") {
+		log.Fatalf("Pass exactly one of -all or -offsets")
+	}
+	wanted, err := parseIDs(*offsets)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	msgs, err := readAll(conf.DeadLetter.Topic)
+	if err != nil {
+		log.Fatalf("Failed to read %s: %v", conf.DeadLetter.Topic, err)
+	}
+
+	var selected []kafka.Message
+	for _, m := range msgs {
+		if !*all && !wanted[fmt.Sprintf("%d:%d", m.Partition, m.Offset)] {
+			continue
+		}
+		if *stage != "" && queue.Header(m, queue.HeaderStage) != *stage {
+			continue
+		}
+		selected = append(selected, queue.Redrive(m))
+		fmt.Printf("🔁 %d:%d %s\n", m.Partition, m.Offset, m.Value)
+	}
+
+	if len(selected) == 0 {
+		fmt.Println("Nothing to re-drive.")
+		return
+	}
+	if *dryRun {
+		fmt.Printf("Dry run: %d message(s) would be re-driven to %s\n", len(selected), queue.MainTopic)
+		return
+	}
+
+	writer := &kafka.Writer{
+		Addr:         kafka.TCP(conf.KafkaUrl),
+		Topic:        queue.MainTopic,
+		Balancer:     &kafka.Hash{},
+		RequiredAcks: kafka.RequireAll,
+	}
+	defer writer.Close()
+
+	if err := writer.WriteMessages(context.Background(), selected...); err != nil {
+		log.Fatalf("Failed to re-drive messages: %v", err)
+	}
+	fmt.Printf("📨 Re-drove %d message(s) to %s\n", len(selected), queue.MainTopic)
+}
+
+func parseIDs(s string) (map[string]bool, error) {
+	ids := make(map[string]bool)
+	if s == "" {
+		return ids, nil
+	}
+	for _, id := range strings.Split(s, ",") {
+		id = strings.TrimSpace(id)
+		p, o, ok := strings.Cut(id, ":")
+		if !ok {
+			return nil, fmt.Errorf("invalid message ID %q (want partition:offset)", id)
+		}
+		if _, err := strconv.Atoi(p); err != nil {
+			return nil, fmt.Errorf("invalid partition in %q", id)
+		}
+		if _, err := strconv.ParseInt(o, 10, 64); err != nil {
+			return nil, fmt.Errorf("invalid offset in %q", id)
+		}
+		ids[id] = true
+	}
+	return ids, nil
+}
+
+// readAll reads every message currently on topic, partition by partition,
+// without joining a consumer group or committing anything.
+func readAll(topic string) ([]kafka.Message, error) {
+	conn, err := kafka.Dial("tcp", conf.KafkaUrl)
+	if err != nil {
+		return nil, err
+	}
+	partitions, err := conn.ReadPartitions(topic)
+	conn.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	var msgs []kafka.Message
+	for _, p := range partitions {
+		got, err := readPartition(topic, p.ID)
+		if err != nil {
+			return nil, fmt.Errorf("partition %d: %w", p.ID, err)
+		}
+		msgs = append(msgs, got...)
+	}
+	return msgs, nil
+}
+
+// readPartition reads partition from its first offset up to the high
+// watermark it had when we started. The deadline is only a backstop: the
+// read ends as soon as nothing is left to read.
+func readPartition(topic string, partition int) ([]kafka.Message, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	leader, err := kafka.DialLeader(ctx, "tcp", conf.KafkaUrl, topic, partition)
+	if err != nil {
+		return nil, err
+	}
+	first, last, err := leader.ReadOffsets()
+	leader.Close()
+	if err != nil {
+		return nil, err
+	}
+	if first >= last {
+		return nil, nil
+	}
+
+	reader := kafka.NewReader(kafka.ReaderConfig{
+		Brokers:   []string{conf.KafkaUrl},
+		Topic:     topic,
+		Partition: partition,
+		MaxBytes:  10e6,
+	})
+	defer reader.Close()
+	if err := reader.SetOffset(first); err != nil {
+		return nil, err
+	}
+
+	var msgs []kafka.Message
+	next := first
+	for next < last {
+		m, err := reader.ReadMessage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("read up to offset %d of %d: %w", next, last, err)
+		}
+		msgs = append(msgs, m)
+		next = m.Offset + 1
+		// Offsets may have gaps (compaction, transaction markers), so the
+		// lag behind the high watermark says when we are caught up, not
+		// the offset we expected last.
+		if reader.Lag() <= 0 {
+			break
+		}
+	}
+	return msgs, nil
+}
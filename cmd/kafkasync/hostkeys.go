@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"text/tabwriter"
+
+	"github.com/Mwambama/KafkaSync/internal/store"
+)
+
+// runHostKeys handles the host keys recorded by the trust-on-first-use
+// policy. After a legitimate key rotation, forget the old key so the next
+// connection records the new one.
+func runHostKeys(args []string) {
+	if len(args) < 1 {
+		usage()
+	}
+
+	db, err := store.Connect(conf.Database)
+	if err != nil {
+		log.Fatalf("Failed to open DB: %v", err)
+	}
+	defer db.Close()
+	ctx := context.Background()
+
+	switch args[0] {
+	case "list":
+		keys, err := db.HostKeys(ctx)
+		if err != nil {
+			log.Fatal(err)
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "HOST\tTYPE\tFINGERPRINT\tFIRST SEEN")
+		for _, k := range keys {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", k.Host, k.KeyType, k.Fingerprint, k.FirstSeen.Local().Format("2006-01-02 15:04:05"))
+		}
+		w.Flush()
+
+	case "forget":
+		if len(args) != 2 {
+			usage()
+		}
+		removed, err := db.ForgetHostKey(ctx, args[1])
+		if err != nil {
+			log.Fatal(err)
+		}
+		if !removed {
+			log.Fatalf("No host key recorded for %s", args[1])
+		}
+		fmt.Printf("✅ Forgot host key for %s; the next connection will record a new one\n", args[1])
+
+	default:
+		usage()
+	}
+}
@@ -0,0 +1,82 @@
+// Command kafkasync holds operator tooling for a running KafkaSync setup.
+//
+//	kafkasync [--config path] <command>
+//
+//	kafkasync dlq list    [-stage download]
+//	kafkasync dlq redrive (-all | -offsets 0:12,1:40) [-stage download] [-dry-run]
+//	kafkasync migrate     up | down [-steps N] | status
+//	kafkasync hostkeys    list | forget <host>
+//	kafkasync config      print
+//	kafkasync watch       [-once] [name ...]
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/Mwambama/KafkaSync/internal/config"
+)
+
+var conf *config.Config
+
+func usage() {
+	fmt.Fprintln(os.Stderr, `usage: kafkasync [--config path] <command> [arguments]
+
+commands:
+  dlq list      show messages on the dead-letter topic
+  dlq redrive   publish selected dead-letter messages back onto kafkasync-files
+  migrate up    apply pending database migrations
+  migrate down  roll back the latest migration (-steps N for more)
+  migrate status
+                list migrations and whether they are applied
+  hostkeys list list host keys recorded by trust-on-first-use
+  hostkeys forget <host>
+                drop a recorded host key after a legitimate key change
+  config print  show the effective config (file plus KAFKASYNC_* overrides), secrets redacted
+  watch [-once] [name ...]
+                poll the [watch.<name>] directories and publish new or changed files`)
+	os.Exit(2)
+}
+
+func main() {
+	log.SetFlags(0)
+	configPath := flag.String("config", config.Path(), "path to config.toml")
+	flag.Usage = usage
+	flag.Parse()
+	args := flag.Args()
+	if len(args) < 1 {
+		usage()
+	}
+
+	var err error
+	if conf, err = config.Load(*configPath); err != nil {
+		log.Fatalf("Failed to load config %s: %v", *configPath, err)
+	}
+
+	switch args[0] {
+	case "dlq":
+		validate(config.NeedKafka)
+		runDLQ(args[1:])
+	case "migrate":
+		validate(config.NeedDatabase)
+		runMigrate(args[1:])
+	case "hostkeys":
+		validate(config.NeedDatabase)
+		runHostKeys(args[1:])
+	case "config":
+		runConfig(args[1:])
+	case "watch":
+		validate(config.NeedKafka | config.NeedDatabase)
+		runWatch(args[1:])
+	default:
+		usage()
+	}
+}
+
+func validate(need config.Requirement) {
+	if err := conf.Validate(need); err != nil {
+		log.Fatal(err)
+	}
+}
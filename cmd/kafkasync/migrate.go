@@ -0,0 +1,82 @@
+package main
+
+import (
+	"database/sql"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"text/tabwriter"
+
+	"github.com/Mwambama/KafkaSync/internal/migrate"
+	"github.com/Mwambama/KafkaSync/internal/store"
+)
+
+func openDB() *sql.DB {
+	db, err := store.Open(conf.Database)
+	if err != nil {
+		log.Fatalf("Failed to open DB: %v", err)
+	}
+	return db
+}
+
+func runMigrate(args []string) {
+	if len(args) < 1 {
+		usage()
+	}
+
+	db := openDB()
+	defer db.Close()
+
+	switch args[0] {
+	case "up":
+		ran, err := migrate.Up(db)
+		for _, m := range ran {
+			fmt.Printf("⬆️  %04d_%s\n", m.Version, m.Name)
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+		if len(ran) == 0 {
+			fmt.Println("✅ Schema already up to date")
+		} else {
+			fmt.Printf("✅ Applied %d migration(s), schema at version %d\n", len(ran), migrate.Latest())
+		}
+
+	case "down":
+		fs := flag.NewFlagSet("migrate down", flag.ExitOnError)
+		steps := fs.Int("steps", 1, "number of migrations to roll back")
+		fs.Parse(args[1:])
+
+		undone, err := migrate.Down(db, *steps)
+		for _, m := range undone {
+			fmt.Printf("⬇️  %04d_%s\n", m.Version, m.Name)
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Printf("✅ Rolled back %d migration(s)\n", len(undone))
+
+	case "status":
+		states, err := migrate.Status(db)
+		if err != nil {
+			log.Fatal(err)
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED AT")
+		for _, s := range states {
+			at := "pending"
+			if s.Applied {
+				at = s.AppliedAt.Local().Format("2006-01-02 15:04:05")
+			}
+			if s.Modified {
+				at += " (file changed since)"
+			}
+			fmt.Fprintf(w, "%04d\t%s\t%s\n", s.Version, s.Name, at)
+		}
+		w.Flush()
+
+	default:
+		usage()
+	}
+}
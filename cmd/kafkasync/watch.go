@@ -0,0 +1,292 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"flag"
+	"log"
+	"log/slog"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/Mwambama/KafkaSync/internal/config"
+	"github.com/Mwambama/KafkaSync/internal/logging"
+	"github.com/Mwambama/KafkaSync/internal/model"
+	"github.com/Mwambama/KafkaSync/internal/queue"
+	"github.com/Mwambama/KafkaSync/internal/store"
+	"github.com/Mwambama/KafkaSync/internal/transfer"
+	"github.com/google/uuid"
+	"github.com/segmentio/kafka-go"
+)
+
+const defaultWatchInterval = time.Minute
+
+// watcher polls one [watch.<name>] directory.
+type watcher struct {
+	name   string
+	conf   config.Watch
+	remote string
+	lister transfer.Lister
+	ready  string   // the remote's ready policy, "" when files are complete once listed
+	marker []string // the remote's marker suffixes, if it uses ready = "marker"
+	db     *store.Store
+	writer *kafka.Writer
+	log    *slog.Logger
+}
+
+// runWatch polls the configured directories and publishes a notification
+// for every new or changed file, until interrupted. What was published is
+// kept in watched_files, so a restart picks up where it left off.
+func runWatch(args []string) {
+	fs := flag.NewFlagSet("watch", flag.ExitOnError)
+	once := fs.Bool("once", false, "poll every directory once and exit")
+	fs.Parse(args)
+	if len(conf.Watch) == 0 {
+		log.Fatalf("No [watch.<name>] tables configured")
+	}
+	names := fs.Args()
+	if len(names) == 0 {
+		for name := range conf.Watch {
+			names = append(names, name)
+		}
+	}
+
+	logFile, err := logging.Setup(conf.LogConfig().WithDefaults("stdout", "watch.log"), conf.Secrets()...)
+	if err != nil {
+		log.Fatalf("Failed to set up logging: %v", err)
+	}
+	defer logFile.Close()
+
+	db, err := store.Connect(conf.Database)
+	if err != nil {
+		log.Fatalf("Failed to open DB: %v", err)
+	}
+	defer db.Close()
+
+	writer := kafka.NewWriter(kafka.WriterConfig{
+		Brokers:  []string{conf.KafkaUrl},
+		Topic:    queue.MainTopic,
+		Balancer: &kafka.Hash{}, // by key, so jobs for one file stay on one partition
+	})
+	defer writer.Close()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	var wg sync.WaitGroup
+	for _, name := range names {
+		w, err := newWatcher(name, db, writer)
+		if err != nil {
+			log.Fatalf("watch.%s: %v", name, err)
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			w.run(ctx, *once)
+		}()
+	}
+	wg.Wait()
+}
+
+func newWatcher(name string, db *store.Store, writer *kafka.Writer) (*watcher, error) {
+	wc, ok := conf.Watch[name]
+	if !ok {
+		return nil, errors.New("not configured")
+	}
+	remote := cmp.Or(wc.Remote, conf.DefaultRemoteName())
+	details := conf.AllRemotes()[remote]
+	backend, err := transfer.New(transfer.Remote{
+		Backend:  details.Backend,
+		Host:     details.Host,
+		Username: details.Username,
+		Password: details.Password,
+		Root:     details.Root,
+		UseSSL:   details.UseSSL,
+		Region:   details.Region,
+
+		PrivateKey:    details.PrivateKey,
+		Passphrase:    details.Passphrase,
+		AgentSocket:   details.AgentSocket,
+		KnownHosts:    details.KnownHosts,
+		HostKey:       details.HostKey,
+		HostKeyPolicy: details.HostKeyPolicy,
+		HostKeys:      db,
+	})
+	if err != nil {
+		return nil, err
+	}
+	lister, ok := backend.(transfer.Lister)
+	if !ok {
+		return nil, errors.New("the " + cmp.Or(details.Backend, "lftp") + " backend cannot list directories")
+	}
+	w := &watcher{
+		name:   name,
+		conf:   wc,
+		remote: remote,
+		lister: lister,
+		ready:  strings.ToLower(details.Ready),
+		db:     db,
+		writer: writer,
+		log:    slog.With("watch", name, "remote", remote, "location", wc.Location),
+	}
+	if strings.EqualFold(details.Ready, "marker") {
+		w.marker = details.MarkerSuffixes()
+	}
+	return w, nil
+}
+
+func (w *watcher) run(ctx context.Context, once bool) {
+	interval := defaultWatchInterval
+	if w.conf.Interval != "" {
+		interval, _ = time.ParseDuration(w.conf.Interval) // checked by Validate
+	}
+	w.log.Info("Watching", "interval", interval)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := w.poll(ctx); err != nil && ctx.Err() == nil {
+			w.log.Error("Poll failed", "error", err)
+		}
+		if once {
+			return
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// poll lists the directory and publishes every file whose size or
+// modification time differs from what was last published. Entries listed
+// without either are looked up with Stat where the remote has it. A file is
+// recorded only after its message is written, so a crash in between
+// publishes it again rather than losing it.
+func (w *watcher) poll(ctx context.Context) error {
+	entries, err := w.lister.List(ctx, transfer.Job{Location: w.conf.Location})
+	if err != nil {
+		return err
+	}
+	seen, err := w.db.WatchedFiles(ctx, w.name)
+	if err != nil {
+		return err
+	}
+
+	published := 0
+	present := make(map[string]bool, len(entries))
+	for _, e := range entries {
+		if !transfer.Selected(e.Path, w.conf.Include, w.conf.Exclude) || w.isMarker(e.Path) {
+			continue
+		}
+		present[e.Path] = true
+		if e.Size < 0 && e.ModTime.IsZero() {
+			// lftp's find lists names only; without a size or time a
+			// changed file would look the same as before.
+			if stater, ok := w.lister.(transfer.Stater); ok {
+				info, err := stater.Stat(ctx, transfer.Job{Location: w.conf.Location, Name: e.Path})
+				if err != nil {
+					if ctx.Err() != nil {
+						return ctx.Err()
+					}
+					w.log.Warn("Could not stat, trying again next poll", "file", e.Path, "error", err)
+					continue
+				}
+				e.Size, e.ModTime = info.Size, info.ModTime
+			}
+		}
+		// Postgres keeps microseconds.
+		e.ModTime = e.ModTime.Truncate(time.Microsecond)
+		if old, ok := seen[e.Path]; ok && old.Size == e.Size && old.ModTime.Equal(e.ModTime) {
+			continue
+		}
+		if err := w.publish(ctx, e); err != nil {
+			return err
+		}
+		published++
+	}
+
+	var gone []string
+	for p := range seen {
+		if !present[p] {
+			gone = append(gone, p)
+		}
+	}
+	if err := w.db.ForgetWatched(ctx, w.name, gone); err != nil {
+		return err
+	}
+	w.log.Debug("Polled", "files", len(present), "published", published, "gone", len(gone))
+	return nil
+}
+
+// isMarker reports whether p is a ready marker, which travels with its
+// file rather than as a job of its own.
+func (w *watcher) isMarker(p string) bool {
+	for _, suffix := range w.marker {
+		if strings.HasSuffix(p, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+func (w *watcher) publish(ctx context.Context, e transfer.Entry) error {
+	notification := model.DownloadNotification{
+		JobID:    uuid.NewString(),
+		Name:     e.Path,
+		Location: w.conf.Location,
+		Remote:   w.remote,
+	}
+	notification.Hash = w.hash(ctx, notification)
+
+	message, err := queue.Publish(notification)
+	if err != nil {
+		return err
+	}
+	if err := w.writer.WriteMessages(ctx, message); err != nil {
+		return err
+	}
+	w.log.Info("Sent to Kafka", "job_id", notification.JobID, "file", e.Path, "bytes", e.Size, "hash", notification.Hash)
+	return w.db.MarkWatched(ctx, w.name, store.WatchedFile{
+		Path:    e.Path,
+		Size:    e.Size,
+		ModTime: e.ModTime,
+		Hash:    notification.Hash,
+		JobID:   notification.JobID,
+	})
+}
+
+// hash asks the remote for a digest of the file. Remotes that cannot hash
+// in place get an empty info_hash, which the consumer does not verify.
+// Neither do remotes with a ready policy: a listed file may still be
+// written to, and only the consumer's ready check says when it is done.
+func (w *watcher) hash(ctx context.Context, n model.DownloadNotification) string {
+	want := strings.ToLower(w.conf.Hash)
+	hasher, ok := w.lister.(transfer.Hasher)
+	if !ok || want == "none" {
+		return ""
+	}
+	if w.ready != "" {
+		w.log.Debug("File may not be ready, publishing without a hash", "file", n.Name, "ready", w.ready)
+		return ""
+	}
+	algos := []string{"sha256", "md5"}
+	if want != "" {
+		algos = []string{want}
+	}
+	sum, err := hasher.Hash(ctx, transfer.Job{Location: n.Location, Name: n.Name}, algos...)
+	if errors.Is(err, transfer.ErrNoHash) {
+		w.log.Debug("Remote cannot hash, publishing without one", "file", n.Name)
+		return ""
+	}
+	if err != nil {
+		w.log.Warn("Could not hash, publishing without one", "file", n.Name, "error", err)
+		return ""
+	}
+	return sum
+}
@@ -2,27 +2,67 @@ package main
 
 import (
 	"context"
-	"encoding/json"
+	"flag"
 	"fmt"
 	"log"
+	"log/slog"
+	"strings"
 
+	"github.com/Mwambama/KafkaSync/internal/config"
+	"github.com/Mwambama/KafkaSync/internal/logging"
+	"github.com/Mwambama/KafkaSync/internal/model"
+	"github.com/Mwambama/KafkaSync/internal/queue"
+	"github.com/google/uuid"
 	"github.com/segmentio/kafka-go"
 )
 
-type DownloadNotification struct {
-	Hash     string `json:"info_hash"`
-	Name     string `json:"name"`
-	Location string `json:"location"`
-}
-
 func main() {
-	brokerAddress := "localhost:9094"
-	topic := "kafkasync-files"
+	configPath := flag.String("config", config.Path(), "path to config.toml")
+	force := flag.Bool("force", false, "ask the consumer to re-download even if the file is already archived")
+	remote := flag.String("remote", "", "[remotes.<name>] to fetch from, empty for the consumer's default_remote")
+	mirror := flag.Bool("mirror", false, "mirror the directory at the location, recursively, instead of one file")
+	include := flag.String("include", "", "comma-separated globs of files to mirror, empty for all")
+	exclude := flag.String("exclude", "", "comma-separated globs of files to leave out of a mirror")
+	prefix := flag.String("prefix", "", "object key prefix for mirrored files, empty for the directory name")
+	// Empty log flags fall back to the [logging] table.
+	var logFlags logging.Config
+	flag.StringVar(&logFlags.Level, "log-level", "", "debug, info, warn or error")
+	flag.StringVar(&logFlags.Format, "log-format", "", "text or json")
+	flag.StringVar(&logFlags.Output, "log-output", "", "stdout, file or both")
+	flag.StringVar(&logFlags.File, "log-file", "", "log file when -log-output includes file")
+	flag.Parse()
+
+	conf, err := config.Load(*configPath)
+	if err == nil {
+		err = conf.Validate(config.NeedKafka)
+	}
+	if err != nil {
+		log.Fatalf("Failed to load config %s: %v", *configPath, err)
+	}
+
+	logConf := conf.LogConfig()
+	for _, f := range []struct{ flag, conf *string }{
+		{&logFlags.Level, &logConf.Level},
+		{&logFlags.Format, &logConf.Format},
+		{&logFlags.Output, &logConf.Output},
+		{&logFlags.File, &logConf.File},
+	} {
+		if *f.flag != "" {
+			*f.conf = *f.flag
+		}
+	}
+	logFile, err := logging.Setup(logConf.WithDefaults("stdout", "producer.log"), conf.Secrets()...)
+	if err != nil {
+		log.Fatalf("Failed to set up logging: %v", err)
+	}
+	defer logFile.Close()
+
+	topic := queue.MainTopic
 
 	writer := kafka.NewWriter(kafka.WriterConfig{
-		Brokers:  []string{brokerAddress},
+		Brokers:  []string{conf.KafkaUrl},
 		Topic:    topic,
-		Balancer: &kafka.LeastBytes{},
+		Balancer: &kafka.Hash{}, // by key, so jobs for one file stay on one partition
 	})
 	defer writer.Close()
 
@@ -37,30 +77,46 @@ func main() {
 		fmt.Print("📄 Enter file name: ")
 		fmt.Scanln(&name)
 
-		fmt.Print("🌐 Enter remote location path: ")
+		fmt.Print("🌐 Enter remote location path or source URI: ")
 		fmt.Scanln(&location)
 
-		notification := DownloadNotification{
+		notification := model.DownloadNotification{
+			JobID:    uuid.NewString(),
 			Hash:     hash,
 			Name:     name,
 			Location: location,
+			Force:    *force,
+			Remote:   *remote,
+			Mirror:   *mirror,
+			Include:  globs(*include),
+			Exclude:  globs(*exclude),
+			Prefix:   *prefix,
+		}
+		// A full URI (ftps://, https://, s3://, file://) is sent as the
+		// source; the name may then be left blank.
+		if strings.Contains(location, "://") {
+			notification.Location, notification.Source = "", location
 		}
 
-		payload, err := json.Marshal(notification)
+		message, err := queue.Publish(notification)
 		if err != nil {
-			log.Printf("❌ JSON encode failed: %v", err)
+			slog.Error("JSON encode failed", "error", err)
 			continue
 		}
 
-		err = writer.WriteMessages(context.Background(), kafka.Message{
-			Key:   []byte(name),
-			Value: payload,
-		})
+		err = writer.WriteMessages(context.Background(), message)
 
 		if err != nil {
-			log.Printf("❌ Failed to send message: %v", err)
+			slog.Error("Failed to send message", "job_id", notification.JobID, "error", err)
 		} else {
-			fmt.Printf("📨 Sent to Kafka: %+v\n", notification)
+			slog.Info("Sent to Kafka", "topic", topic, "job_id", notification.JobID, "file", notification.FileName(), "location", location, "remote", *remote)
 		}
 	}
 }
+
+func globs(list string) []string {
+	if list == "" {
+		return nil
+	}
+	return strings.Split(list, ",")
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/Mwambama/KafkaSync/internal/store"
+)
+
+// getJobs lists the most recent jobs, optionally filtered with ?state=DOWNLOADING.
+func getJobs(w http.ResponseWriter, r *http.Request) {
+	enableCORS(&w)
+
+	jobs, err := db.Jobs(r.Context(), r.URL.Query().Get("state"), 200)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(jobs)
+}
+
+// getJobTimeline returns a job and every state it has passed through.
+func getJobTimeline(w http.ResponseWriter, r *http.Request) {
+	enableCORS(&w)
+
+	timeline, err := db.Timeline(r.Context(), r.PathValue("id"))
+	if errors.Is(err, store.ErrNotFound) {
+		http.Error(w, "job not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(timeline)
+}
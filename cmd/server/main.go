@@ -1,61 +1,37 @@
 package main
 
 import (
-	"database/sql"
 	"encoding/json"
-	"fmt"
+	"flag"
 	"log"
+	"log/slog"
 	"net/http"
+	"time"
 
-	"github.com/BurntSushi/toml"
-	_ "github.com/lib/pq"
+	"github.com/Mwambama/KafkaSync/internal/config"
+	"github.com/Mwambama/KafkaSync/internal/logging"
+	"github.com/Mwambama/KafkaSync/internal/store"
 )
 
-// Reusing existing config structs
-type tomlConfig struct {
-	Database databaseConfig `toml:"database"`
-}
-
-type databaseConfig struct {
-	Host     string
-	Port     int
-	User     string
-	Password string
-	DbName   string
-}
-
-// data structure for API response
-type DownloadRecord struct {
-	ID             int    `json:"id"`
-	Filename       string `json:"filename"`
-	RemoteLocation string `json:"remote_location"`
-	Hash           string `json:"hash"`
-	Status         string `json:"status"`
-	DownloadedAt   string `json:"downloaded_at"`
-}
+var db *store.Store
 
-var db *sql.DB
-
-func init() {
+func setup(path string) {
 	// Load the same config file for consumer
-	var conf tomlConfig
-	if _, err := toml.DecodeFile("config.toml", &conf); err != nil {
-		log.Fatalf("❌ Failed to load config: %v", err)
+	conf, err := config.Load(path)
+	if err == nil {
+		err = conf.Validate(config.NeedDatabase)
 	}
-
-	// Connect to DB
-	connStr := fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=disable",
-		conf.Database.Host, conf.Database.Port, conf.Database.User, conf.Database.Password, conf.Database.DbName)
-
-	var err error
-	db, err = sql.Open("postgres", connStr)
 	if err != nil {
-		log.Fatalf("❌ Failed to open DB: %v", err)
+		log.Fatalf("Failed to load config %s: %v", path, err)
 	}
-	if err = db.Ping(); err != nil {
-		log.Fatalf("❌ Database unreachable: %v", err)
+	if _, err := logging.Setup(conf.LogConfig().WithDefaults("stdout", "server.log"), conf.Secrets()...); err != nil {
+		log.Fatalf("Failed to set up logging: %v", err)
+	}
+
+	if db, err = store.Connect(conf.Database); err != nil {
+		logging.Fatal("Failed to connect to database", "error", err)
 	}
-	log.Println("✅ API Server connected to Database")
+	slog.Info("API Server connected to Database")
 }
 
 // enableCORS allows the React app (on port 5173) to call this API (on port 8080)
@@ -68,31 +44,46 @@ func enableCORS(w *http.ResponseWriter) {
 func getDownloads(w http.ResponseWriter, r *http.Request) {
 	enableCORS(&w) // Enable access for React
 
-	rows, err := db.Query("SELECT id, filename, remote_location, hash, status, downloaded_at FROM downloads ORDER BY id DESC")
+	downloads, err := db.Downloads(r.Context())
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-	defer rows.Close()
-
-	var downloads []DownloadRecord
-	for rows.Next() {
-		var d DownloadRecord
-		// Scan timestamps as strings for simplicity
-		if err := rows.Scan(&d.ID, &d.Filename, &d.RemoteLocation, &d.Hash, &d.Status, &d.DownloadedAt); err != nil {
-			log.Println("Error scanning row:", err)
-			continue
-		}
-		downloads = append(downloads, d)
-	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(downloads)
 }
 
+// statusRecorder remembers the status code for the access log.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// accessLog logs one line per request at debug level.
+func accessLog(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		started := time.Now()
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r)
+		slog.Debug("request", "method", r.Method, "path", r.URL.Path, "status", rec.status, "duration", time.Since(started))
+	})
+}
+
 func main() {
+	configPath := flag.String("config", config.Path(), "path to config.toml")
+	flag.Parse()
+	setup(*configPath)
+
 	http.HandleFunc("/api/downloads", getDownloads)
+	http.HandleFunc("/api/jobs", getJobs)
+	http.HandleFunc("/api/jobs/{id}/timeline", getJobTimeline)
 
-	log.Println("🚀 API Server running on http://localhost:8080")
-	log.Fatal(http.ListenAndServe(":8080", nil))
+	slog.Info("API Server running", "url", "http://localhost:8080")
+	logging.Fatal("API Server stopped", "error", http.ListenAndServe(":8080", accessLog(http.DefaultServeMux)))
 }
@@ -0,0 +1,112 @@
+// Package checksum verifies downloaded files against the "algo:hex" hashes
+// carried in DownloadNotification.info_hash.
+package checksum
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/cespare/xxhash/v2"
+)
+
+// ErrNoAlgorithm means the hash has no "algo:" prefix, so there is nothing
+// to verify against. Older producers send bare hashes like this.
+var ErrNoAlgorithm = errors.New("hash has no algorithm prefix")
+
+var algorithms = map[string]func() hash.Hash{
+	"sha256": sha256.New,
+	"md5":    md5.New,
+	"crc32c": func() hash.Hash { return crc32.New(crc32.MakeTable(crc32.Castagnoli)) },
+	"xxh64":  func() hash.Hash { return xxhash.New() },
+}
+
+// Sum is a parsed "algo:hex" hash.
+type Sum struct {
+	Algo string
+	Hex  string
+}
+
+func (s Sum) String() string { return s.Algo + ":" + s.Hex }
+
+// Parse splits an "algo:hex" string and checks that the algorithm is known
+// and the digest has the right length.
+func Parse(s string) (Sum, error) {
+	algo, digest, ok := strings.Cut(strings.TrimSpace(s), ":")
+	if !ok {
+		return Sum{}, ErrNoAlgorithm
+	}
+	algo = strings.ToLower(algo)
+	newHash, known := algorithms[algo]
+	if !known {
+		return Sum{}, fmt.Errorf("unsupported hash algorithm %q", algo)
+	}
+	digest = strings.ToLower(digest)
+	raw, err := hex.DecodeString(digest)
+	if err != nil {
+		return Sum{}, fmt.Errorf("invalid %s digest: %w", algo, err)
+	}
+	if want := newHash().Size(); len(raw) != want {
+		return Sum{}, fmt.Errorf("invalid %s digest: got %d bytes, want %d", algo, len(raw), want)
+	}
+	return Sum{Algo: algo, Hex: digest}, nil
+}
+
+// Supported reports whether algo can be used in a hash.
+func Supported(algo string) bool {
+	_, ok := algorithms[algo]
+	return ok
+}
+
+// File hashes the file at path with algo and returns the hex digest.
+func File(path, algo string) (string, error) {
+	newHash, ok := algorithms[algo]
+	if !ok {
+		return "", fmt.Errorf("unsupported hash algorithm %q", algo)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := newHash()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// MismatchError reports a file whose content does not match the expected hash.
+type MismatchError struct {
+	Expected Sum
+	Actual   string
+}
+
+func (e *MismatchError) Error() string {
+	return fmt.Sprintf("%s mismatch: expected %s, got %s", e.Expected.Algo, e.Expected.Hex, e.Actual)
+}
+
+// Verify checks the file at path against expected. It returns ErrNoAlgorithm
+// for bare hashes and a *MismatchError when the digests differ.
+func Verify(path, expected string) error {
+	want, err := Parse(expected)
+	if err != nil {
+		return err
+	}
+	got, err := File(path, want.Algo)
+	if err != nil {
+		return err
+	}
+	if got != want.Hex {
+		return &MismatchError{Expected: want, Actual: got}
+	}
+	return nil
+}
@@ -0,0 +1,82 @@
+package checksum
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/cespare/xxhash/v2"
+)
+
+var content = []byte("hello")
+
+// digests of content for every supported algorithm.
+func digests() map[string]string {
+	crc := binary.BigEndian.AppendUint32(nil, crc32.Checksum(content, crc32.MakeTable(crc32.Castagnoli)))
+	xxh := binary.BigEndian.AppendUint64(nil, xxhash.Sum64(content))
+	return map[string]string{
+		"sha256": "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824",
+		"md5":    "5d41402abc4b2a76b9719d911017c592",
+		"crc32c": hex.EncodeToString(crc),
+		"xxh64":  hex.EncodeToString(xxh),
+	}
+}
+
+func TestParse(t *testing.T) {
+	for algo, digest := range digests() {
+		for _, in := range []string{algo + ":" + digest, " " + strings.ToUpper(algo) + ":" + strings.ToUpper(digest) + "\n"} {
+			got, err := Parse(in)
+			if err != nil || got != (Sum{Algo: algo, Hex: digest}) {
+				t.Errorf("Parse(%q) = %v, %v; want %s:%s", in, got, err, algo, digest)
+			}
+		}
+	}
+
+	if _, err := Parse(digests()["sha256"]); !errors.Is(err, ErrNoAlgorithm) {
+		t.Errorf("bare hash: err = %v, want ErrNoAlgorithm", err)
+	}
+	rejected := map[string]string{
+		"sha1:aaf4c61ddcc5e8a2dabede0f3b482cd9aea9434d": "unsupported",
+		"sha256:5d41402abc4b2a76b9719d911017c592":       "got 16 bytes, want 32",
+		"md5:" + digests()["sha256"]:                    "got 32 bytes, want 16",
+		"crc32c:abc":                                    "invalid crc32c digest",
+		"xxh64:zzzzzzzzzzzzzzzz":                        "invalid xxh64 digest",
+		"md5:":                                          "got 0 bytes, want 16",
+	}
+	for in, want := range rejected {
+		if _, err := Parse(in); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("Parse(%q) = %v, want an error containing %q", in, err, want)
+		}
+	}
+}
+
+func TestVerify(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "hello.txt")
+	if err := os.WriteFile(path, content, 0644); err != nil {
+		t.Fatal(err)
+	}
+	for algo, digest := range digests() {
+		if err := Verify(path, algo+":"+digest); err != nil {
+			t.Errorf("Verify(%s) = %v", algo, err)
+		}
+	}
+
+	wrong := "sha256:" + strings.Repeat("0", 64)
+	var mismatch *MismatchError
+	if err := Verify(path, wrong); !errors.As(err, &mismatch) || mismatch.Actual != digests()["sha256"] {
+		t.Errorf("Verify(%s) = %v, want a *MismatchError with the actual digest", wrong, err)
+	}
+	// Bare hashes are accepted unverified: the caller gets ErrNoAlgorithm
+	// and decides, even when the file does not match.
+	if err := Verify(path, "0123456789abcdef"); !errors.Is(err, ErrNoAlgorithm) {
+		t.Errorf("bare hash: err = %v, want ErrNoAlgorithm", err)
+	}
+	if err := Verify(filepath.Join(t.TempDir(), "missing"), "md5:"+digests()["md5"]); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("missing file: err = %v, want a not-exist error", err)
+	}
+}
@@ -0,0 +1,195 @@
+// Package config is the config.toml shared by every KafkaSync binary. Each
+// binary reads the parts it needs; unknown or unused tables are ignored.
+package config
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/BurntSushi/toml"
+	"github.com/Mwambama/KafkaSync/internal/logging"
+)
+
+// DefaultPath is where the binaries look for their config unless
+// KAFKASYNC_CONFIG or --config says otherwise.
+const DefaultPath = "config.toml"
+
+// Path is the default for each binary's --config flag.
+func Path() string {
+	if p := os.Getenv(EnvPrefix + "CONFIG"); p != "" {
+		return p
+	}
+	return DefaultPath
+}
+
+type Config struct {
+	KafkaUrl       string                   `toml:"kafka_url"`
+	NumThreads     int                      `toml:"num_threads"`     // lftp/native segments per file
+	ConcurrentJobs int                      `toml:"concurrent_jobs"` // files processed in parallel
+	ShutdownGrace  string                   `toml:"shutdown_grace"`  // how long in-flight jobs get on SIGTERM
+	InstanceID     string                   `toml:"instance_id"`     // recorded on every row, defaults to host-pid
+	MetricsAddr    string                   `toml:"metrics_addr"`    // e.g. ":9102", empty disables /metrics
+	DebugLevel     string                   `toml:"debug_level"`     // superseded by logging.level
+	Logging        logging.Config           `toml:"logging"`
+	RemoteDetails  RemoteDetails            `toml:"remoteDetails"` // the single remote of older configs, named "default"
+	Remotes        map[string]RemoteDetails `toml:"remotes"`
+	DefaultRemote  string                   `toml:"default_remote"` // for messages without a remote
+	Locations      Locations                `toml:"locations"`
+	Database       Database                 `toml:"database"`
+	ObjectStorage  ObjectStorage            `toml:"objectStorage"`
+	DeadLetter     DeadLetter               `toml:"deadLetter"`
+	Retry          Retry                    `toml:"retry"`
+	Dedupe         Dedupe                   `toml:"dedupe"`
+	Watch          map[string]Watch         `toml:"watch"` // directories `kafkasync watch` polls
+
+	// problems found while loading, reported by Validate.
+	problems []string
+}
+
+type RemoteDetails struct {
+	Host     string `toml:"host"`
+	Username string `toml:"username"`
+	Password string `toml:"password" secret:"true"`
+	Backend  string `toml:"backend"` // transfer backend, see transfer.Backends()
+
+	Root   string `toml:"root"`    // file backend: directory sources must be under
+	UseSSL bool   `toml:"use_ssl"` // s3 backend: HTTPS to the endpoint in host
+	Region string `toml:"region"`  // s3 backend: bucket region
+
+	PrivateKey    string `toml:"private_key"`              // path to an SSH private key
+	Passphrase    string `toml:"passphrase" secret:"true"` // for an encrypted private_key
+	AgentSocket   string `toml:"agent_socket"`             // e.g. "$SSH_AUTH_SOCK"
+	KnownHosts    string `toml:"known_hosts"`              // default ~/.ssh/known_hosts
+	HostKey       string `toml:"host_key"`                 // pinned "SHA256:..." fingerprint
+	HostKeyPolicy string `toml:"host_key_policy"`          // strict, trust-on-first-use or insecure
+
+	ConcurrentJobs int    `toml:"concurrent_jobs"` // downloads from this remote at once, 0 for no cap
+	Subpath        string `toml:"subpath"`         // under incompletes, completes and the bucket
+
+	// When a file counts as completely written: "" (at once), "stable"
+	// (size and modification time unchanged over stable_polls looks) or
+	// "marker" (a companion file such as name.done exists).
+	Ready          string   `toml:"ready"`
+	StablePolls    int      `toml:"stable_polls"`    // default 3
+	StableInterval string   `toml:"stable_interval"` // least time between looks, default "10s"
+	Markers        []string `toml:"markers"`         // suffixes, default [".done", ".ok"]
+	ArchiveMarker  bool     `toml:"archive_marker"`  // also upload the marker next to the file
+	ReadyTimeout   string   `toml:"ready_timeout"`   // stop deferring after this, default "24h"
+}
+
+// MarkerSuffixes is markers, or the default ".done" and ".ok".
+func (r RemoteDetails) MarkerSuffixes() []string {
+	if len(r.Markers) == 0 {
+		return []string{".done", ".ok"}
+	}
+	return r.Markers
+}
+
+// LegacyRemote is the name [remoteDetails] is known by.
+const LegacyRemote = "default"
+
+// set reports whether a remote table has been filled in at all.
+func (r RemoteDetails) set() bool {
+	return r.Host != "" || r.Root != ""
+}
+
+// AllRemotes returns every configured remote by name: the [remotes.*]
+// tables plus [remoteDetails], if it is filled in, as "default".
+func (c *Config) AllRemotes() map[string]RemoteDetails {
+	all := make(map[string]RemoteDetails, len(c.Remotes)+1)
+	if c.RemoteDetails.set() {
+		all[LegacyRemote] = c.RemoteDetails
+	}
+	for name, r := range c.Remotes {
+		all[name] = r
+	}
+	return all
+}
+
+// DefaultRemoteName is the remote used by messages that do not name one:
+// default_remote if set, otherwise the only remote, otherwise "default".
+func (c *Config) DefaultRemoteName() string {
+	if c.DefaultRemote != "" {
+		return c.DefaultRemote
+	}
+	all := c.AllRemotes()
+	if len(all) == 1 {
+		for name := range all {
+			return name
+		}
+	}
+	return LegacyRemote
+}
+
+type Locations struct {
+	Incompletes string `toml:"incompletes"`
+	Completes   string `toml:"completes"`
+}
+
+type Database struct {
+	Host     string `toml:"host"`
+	Port     int    `toml:"port"`
+	User     string `toml:"user"`
+	Password string `toml:"password" secret:"true"`
+	DbName   string `toml:"dbname"`
+}
+
+type ObjectStorage struct {
+	Endpoint  string `toml:"endpoint"`
+	AccessKey string `toml:"access_key"`
+	SecretKey string `toml:"secret_key" secret:"true"`
+	Bucket    string `toml:"bucket"`
+	UseSSL    bool   `toml:"use_ssl"`
+	Region    string `toml:"region"`
+}
+
+type DeadLetter struct {
+	Topic string `toml:"topic"` // empty disables the dead-letter queue
+}
+
+type Retry struct {
+	Tiers       []string `toml:"tiers"`        // delays before attempt 2, 3, ... e.g. ["30s", "5m", "1h"]
+	TopicPrefix string   `toml:"topic_prefix"` // delay topic is prefix + tier
+}
+
+// Watch is a remote directory `kafkasync watch` polls for new and changed
+// files.
+type Watch struct {
+	Remote   string   `toml:"remote"`   // [remotes.<name>], empty for default_remote
+	Location string   `toml:"location"` // directory, polled recursively
+	Interval string   `toml:"interval"` // default "1m"
+	Include  []string `toml:"include"`  // globs, as for mirror jobs
+	Exclude  []string `toml:"exclude"`
+	Hash     string   `toml:"hash"` // sha256, md5 or none; default sha256, then md5
+}
+
+type Dedupe struct {
+	Enabled     bool `toml:"enabled"`
+	CheckBucket bool `toml:"check_bucket"` // also require the object to still be in the bucket
+}
+
+// Load reads the config file at path and applies KAFKASYNC_* environment
+// overrides on top. Unknown keys and unparsable overrides are held back and
+// reported by Validate alongside everything else.
+func Load(path string) (*Config, error) {
+	var c Config
+	md, err := toml.DecodeFile(path, &c)
+	if err != nil {
+		return nil, err
+	}
+	for _, key := range md.Undecoded() {
+		c.problems = append(c.problems, fmt.Sprintf("%s: unknown key", key))
+	}
+	c.problems = append(c.problems, c.applyEnv(os.LookupEnv)...)
+	return &c, nil
+}
+
+// LogConfig is the [logging] table with the legacy top-level debug_level
+// standing in for an unset level.
+func (c *Config) LogConfig() logging.Config {
+	l := c.Logging
+	if l.Level == "" {
+		l.Level = c.DebugLevel
+	}
+	return l
+}
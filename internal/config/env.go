@@ -0,0 +1,144 @@
+package config
+
+import (
+	"fmt"
+	"maps"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// EnvPrefix starts every environment override. The rest of the name is the
+// TOML path upper-cased with dots and dashes as underscores, so
+// database.password is KAFKASYNC_DATABASE_PASSWORD and
+// remotes.eu-sftp.password is KAFKASYNC_REMOTES_EU_SFTP_PASSWORD. Lists are
+// comma-separated. Map entries such as remotes can only be overridden, not
+// created, from the environment.
+const EnvPrefix = "KAFKASYNC_"
+
+// field is one leaf key of the config.
+type field struct {
+	path   string // TOML path, e.g. "database.password"
+	value  reflect.Value
+	secret bool
+}
+
+func (f field) env() string {
+	return EnvPrefix + strings.ToUpper(strings.NewReplacer(".", "_", "-", "_").Replace(f.path))
+}
+
+// walk calls visit for every leaf key under v, a pointer to a struct.
+func walk(v reflect.Value, prefix string, visit func(field)) {
+	v = v.Elem()
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if !sf.IsExported() {
+			continue
+		}
+		key, _, _ := strings.Cut(sf.Tag.Get("toml"), ",")
+		if key == "-" {
+			continue
+		}
+		if key == "" {
+			key = strings.ToLower(sf.Name)
+		}
+		path := key
+		if prefix != "" {
+			path = prefix + "." + key
+		}
+
+		fv := v.Field(i)
+		if fv.Kind() == reflect.Struct {
+			walk(fv.Addr(), path, visit)
+			continue
+		}
+		if fv.Kind() == reflect.Map && fv.Type().Elem().Kind() == reflect.Struct {
+			// Map values are not addressable: walk a copy and store it back.
+			for _, k := range fv.MapKeys() {
+				elem := reflect.New(fv.Type().Elem())
+				elem.Elem().Set(fv.MapIndex(k))
+				walk(elem, path+"."+k.String(), visit)
+				fv.SetMapIndex(k, elem.Elem())
+			}
+			continue
+		}
+		visit(field{path: path, value: fv, secret: sf.Tag.Get("secret") == "true"})
+	}
+}
+
+// applyEnv overrides fields from the environment and returns a problem for
+// every value that does not parse.
+func (c *Config) applyEnv(lookup func(string) (string, bool)) []string {
+	var problems []string
+	walk(reflect.ValueOf(c), "", func(f field) {
+		raw, ok := lookup(f.env())
+		if !ok {
+			return
+		}
+		if err := set(f.value, raw); err != nil {
+			problems = append(problems, fmt.Sprintf("%s: %s: %v", f.path, f.env(), err))
+		}
+	})
+	return problems
+}
+
+func set(v reflect.Value, raw string) error {
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(raw)
+	case reflect.Int, reflect.Int64:
+		n, err := strconv.ParseInt(strings.TrimSpace(raw), 10, 64)
+		if err != nil {
+			return fmt.Errorf("want an integer, got %q", raw)
+		}
+		v.SetInt(n)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(strings.TrimSpace(raw))
+		if err != nil {
+			return fmt.Errorf("want true or false, got %q", raw)
+		}
+		v.SetBool(b)
+	case reflect.Slice:
+		if v.Type().Elem().Kind() != reflect.String {
+			return fmt.Errorf("cannot be set from the environment")
+		}
+		var items []string
+		for _, item := range strings.Split(raw, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		v.Set(reflect.ValueOf(items))
+	default:
+		return fmt.Errorf("cannot be set from the environment")
+	}
+	return nil
+}
+
+// Redacted returns a copy of c with every secret that is set replaced, for
+// printing.
+func (c *Config) Redacted() *Config {
+	out := *c
+	// walk stores map entries back, so the maps must not be shared with c.
+	out.Remotes = maps.Clone(c.Remotes)
+	out.Watch = maps.Clone(c.Watch)
+	walk(reflect.ValueOf(&out), "", func(f field) {
+		if f.secret && f.value.Kind() == reflect.String && f.value.String() != "" {
+			f.value.SetString("********")
+		}
+	})
+	return &out
+}
+
+// Secrets returns the value of every secret key that is set, for the log
+// redaction layer.
+func (c *Config) Secrets() []string {
+	var secrets []string
+	walk(reflect.ValueOf(c), "", func(f field) {
+		if f.secret && f.value.Kind() == reflect.String && f.value.String() != "" {
+			secrets = append(secrets, f.value.String())
+		}
+	})
+	return secrets
+}
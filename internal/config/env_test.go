@@ -0,0 +1,111 @@
+package config
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestApplyEnv(t *testing.T) {
+	c := Config{
+		NumThreads: 4,
+		Remotes:    map[string]RemoteDetails{"eu-sftp": {Host: "eu.example.com", Password: "old"}},
+		Watch:      map[string]Watch{"inbox": {Location: "/in"}},
+	}
+	env := map[string]string{
+		"KAFKASYNC_NUM_THREADS":                 " 8 ",
+		"KAFKASYNC_DEDUPE_ENABLED":              "true",
+		"KAFKASYNC_RETRY_TIERS":                 "30s, 5m,,1h",
+		"KAFKASYNC_DATABASE_PASSWORD":           "db-secret",
+		"KAFKASYNC_REMOTES_EU_SFTP_PASSWORD":    "new",
+		"KAFKASYNC_WATCH_INBOX_INTERVAL":        "5m",
+		"KAFKASYNC_REMOTES_NEW_REMOTE_HOST":     "ignored.example.com",
+		"KAFKASYNC_OBJECTSTORAGE_USE_SSL":       "yes please",
+		"KAFKASYNC_REMOTESDETAILS_STABLE_POLLS": "3", // no such table
+	}
+	problems := c.applyEnv(func(key string) (string, bool) {
+		v, ok := env[key]
+		return v, ok
+	})
+
+	if c.NumThreads != 8 {
+		t.Errorf("num_threads = %d, want 8", c.NumThreads)
+	}
+	if !c.Dedupe.Enabled {
+		t.Error("dedupe.enabled not set")
+	}
+	if want := []string{"30s", "5m", "1h"}; !reflect.DeepEqual(c.Retry.Tiers, want) {
+		t.Errorf("retry.tiers = %q, want %q", c.Retry.Tiers, want)
+	}
+	if c.Database.Password != "db-secret" {
+		t.Errorf("database.password = %q", c.Database.Password)
+	}
+	if r := c.Remotes["eu-sftp"]; r.Password != "new" || r.Host != "eu.example.com" {
+		t.Errorf("remotes.eu-sftp = %+v, want the password overridden and the host kept", r)
+	}
+	if w := c.Watch["inbox"]; w.Interval != "5m" || w.Location != "/in" {
+		t.Errorf("watch.inbox = %+v, want the interval overridden and the location kept", w)
+	}
+	if _, ok := c.Remotes["new-remote"]; ok || len(c.Remotes) != 1 {
+		t.Errorf("remotes = %v, want no entry created from the environment", c.Remotes)
+	}
+	if len(problems) != 1 || !strings.HasPrefix(problems[0], "objectStorage.use_ssl: KAFKASYNC_OBJECTSTORAGE_USE_SSL: ") {
+		t.Errorf("problems = %q, want one for objectStorage.use_ssl", problems)
+	}
+
+	c = Config{}
+	problems = c.applyEnv(func(key string) (string, bool) {
+		return "many", key == "KAFKASYNC_CONCURRENT_JOBS"
+	})
+	if len(problems) != 1 || !strings.Contains(problems[0], "want an integer") {
+		t.Errorf("problems = %q, want concurrent_jobs rejected as not an integer", problems)
+	}
+}
+
+func TestRedacted(t *testing.T) {
+	c := Config{
+		Database:      Database{Host: "db", Password: "db-secret"},
+		ObjectStorage: ObjectStorage{AccessKey: "AKIA", SecretKey: "s3-secret"},
+		Remotes: map[string]RemoteDetails{
+			"eu": {Host: "eu.example.com", Password: "sftp-secret", Passphrase: "key-secret"},
+			"us": {Host: "us.example.com"},
+		},
+		Watch: map[string]Watch{"inbox": {Location: "/in"}},
+	}
+	r := c.Redacted()
+
+	if r.Database.Password != "********" || r.ObjectStorage.SecretKey != "********" {
+		t.Errorf("redacted = %+v, %+v, want secrets masked", r.Database, r.ObjectStorage)
+	}
+	if eu := r.Remotes["eu"]; eu.Password != "********" || eu.Passphrase != "********" || eu.Host != "eu.example.com" {
+		t.Errorf("redacted remotes.eu = %+v, want secrets masked and the host kept", eu)
+	}
+	if us := r.Remotes["us"]; us.Password != "" {
+		t.Errorf("redacted remotes.us password = %q, want an unset secret left empty", us.Password)
+	}
+	if r.ObjectStorage.AccessKey != "AKIA" {
+		t.Errorf("access_key = %q, want only secrets masked", r.ObjectStorage.AccessKey)
+	}
+
+	if c.Database.Password != "db-secret" || c.ObjectStorage.SecretKey != "s3-secret" ||
+		c.Remotes["eu"].Password != "sftp-secret" || c.Remotes["eu"].Passphrase != "key-secret" {
+		t.Errorf("original changed: %+v, %+v, %+v", c.Database, c.ObjectStorage, c.Remotes)
+	}
+	// Maps are written back to as they are walked; the original's must not
+	// be the ones written.
+	r.Watch["inbox"] = Watch{Location: "/elsewhere"}
+	if c.Watch["inbox"].Location != "/in" {
+		t.Error("Redacted shares the watch map with the original")
+	}
+
+	want := []string{"db-secret", "s3-secret", "sftp-secret", "key-secret"}
+	got := c.Secrets()
+	if len(got) != len(want) {
+		t.Errorf("Secrets() = %q, want %q in any order", got, want)
+	}
+	for _, s := range want {
+		if !strings.Contains(strings.Join(got, "\x00"), s) {
+			t.Errorf("Secrets() = %q, missing %q", got, s)
+		}
+	}
+}
@@ -0,0 +1,189 @@
+package config
+
+import (
+	"cmp"
+	"fmt"
+	"log/slog"
+	pathpkg "path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Requirement names the parts of the config a binary cannot run without.
+type Requirement int
+
+const (
+	NeedKafka    Requirement = 1 << iota // kafka_url
+	NeedDatabase                         // [database]
+	NeedRemote                           // [remoteDetails] or [remotes.*], and [locations]
+	NeedStorage                          // [objectStorage]
+)
+
+// ValidationError lists every problem with the config, each prefixed with
+// its TOML path.
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return "invalid config:\n  " + strings.Join(e.Problems, "\n  ")
+}
+
+// Validate checks that the sections in need are filled in and that every
+// value that is set parses. It reports all problems at once.
+func (c *Config) Validate(need Requirement) error {
+	problems := append([]string(nil), c.problems...)
+	required := func(path, value string) {
+		if strings.TrimSpace(value) == "" {
+			problems = append(problems, fmt.Sprintf("%s: required", path))
+		}
+	}
+	nonNegative := func(path string, n int) {
+		if n < 0 {
+			problems = append(problems, fmt.Sprintf("%s: must not be negative, got %d", path, n))
+		}
+	}
+	duration := func(path, value string) {
+		if value == "" {
+			return
+		}
+		if d, err := time.ParseDuration(value); err != nil || d < 0 {
+			problems = append(problems, fmt.Sprintf("%s: want a duration like \"30s\", got %q", path, value))
+		}
+	}
+	oneOf := func(path, value string, allowed ...string) {
+		if value == "" {
+			return
+		}
+		for _, a := range allowed {
+			if strings.EqualFold(value, a) {
+				return
+			}
+		}
+		problems = append(problems, fmt.Sprintf("%s: want one of %s, got %q", path, strings.Join(allowed, ", "), value))
+	}
+
+	if need&NeedKafka != 0 {
+		required("kafka_url", c.KafkaUrl)
+	}
+	if need&NeedDatabase != 0 {
+		required("database.host", c.Database.Host)
+		required("database.user", c.Database.User)
+		required("database.dbname", c.Database.DbName)
+		if c.Database.Port < 1 || c.Database.Port > 65535 {
+			problems = append(problems, fmt.Sprintf("database.port: want 1-65535, got %d", c.Database.Port))
+		}
+	}
+	if need&NeedRemote != 0 {
+		required("locations.incompletes", c.Locations.Incompletes)
+		required("locations.completes", c.Locations.Completes)
+		if _, ok := c.AllRemotes()[c.DefaultRemoteName()]; !ok && len(c.Remotes) > 0 {
+			problems = append(problems, fmt.Sprintf("default_remote: no remote named %q, want one of %s",
+				c.DefaultRemoteName(), strings.Join(sortedKeys(c.AllRemotes()), ", ")))
+		}
+	}
+	remote := func(path string, r RemoteDetails) {
+		if need&NeedRemote != 0 {
+			switch r.Backend {
+			case "file":
+				required(path+".root", r.Root)
+			case "", "lftp", "lftp-direct", "lftp-wsl", "native", "sftp":
+				required(path+".host", r.Host)
+				required(path+".username", r.Username)
+			default:
+				// ftp, http and s3 allow anonymous access.
+				required(path+".host", r.Host)
+			}
+		}
+		oneOf(path+".host_key_policy", r.HostKeyPolicy, "strict", "trust-on-first-use", "insecure")
+		nonNegative(path+".concurrent_jobs", r.ConcurrentJobs)
+		if r.Subpath != "" && (filepath.IsAbs(r.Subpath) || strings.HasPrefix(filepath.Clean(r.Subpath), "..")) {
+			problems = append(problems, fmt.Sprintf("%s.subpath: must be a relative path inside locations, got %q", path, r.Subpath))
+		}
+		oneOf(path+".ready", r.Ready, "stable", "marker")
+		if r.StablePolls == 1 || r.StablePolls < 0 {
+			problems = append(problems, fmt.Sprintf("%s.stable_polls: want at least 2, got %d", path, r.StablePolls))
+		}
+		duration(path+".stable_interval", r.StableInterval)
+		duration(path+".ready_timeout", r.ReadyTimeout)
+		for _, m := range r.Markers {
+			if m == "" || strings.ContainsAny(m, `/\`) {
+				problems = append(problems, fmt.Sprintf("%s.markers: want a suffix such as \".done\", got %q", path, m))
+			}
+		}
+		if r.Ready != "" && need&NeedRemote != 0 && len(c.Retry.Tiers) == 0 {
+			problems = append(problems, fmt.Sprintf("%s.ready: files that are not ready are deferred on a retry topic, so retry.tiers must be set", path))
+		}
+	}
+	if c.RemoteDetails.set() || len(c.Remotes) == 0 {
+		remote("remoteDetails", c.RemoteDetails)
+	}
+	if _, dup := c.Remotes[LegacyRemote]; dup && c.RemoteDetails.set() {
+		problems = append(problems, fmt.Sprintf("remotes.%s: clashes with [remoteDetails], which is also named %q", LegacyRemote, LegacyRemote))
+	}
+	for _, name := range sortedKeys(c.Remotes) {
+		remote("remotes."+name, c.Remotes[name])
+	}
+
+	for _, name := range sortedKeys(c.Watch) {
+		w, path := c.Watch[name], "watch."+name
+		required(path+".location", w.Location)
+		r := cmp.Or(w.Remote, c.DefaultRemoteName())
+		if _, ok := c.AllRemotes()[r]; !ok {
+			problems = append(problems, fmt.Sprintf("%s.remote: no remote named %q", path, r))
+		}
+		if d, err := time.ParseDuration(w.Interval); w.Interval != "" && (err != nil || d <= 0) {
+			problems = append(problems, fmt.Sprintf("%s.interval: want a positive duration like \"1m\", got %q", path, w.Interval))
+		}
+		for _, pattern := range append(append([]string(nil), w.Include...), w.Exclude...) {
+			if _, err := pathpkg.Match(pattern, ""); err != nil {
+				problems = append(problems, fmt.Sprintf("%s: bad glob %q: %v", path, pattern, err))
+			}
+		}
+		oneOf(path+".hash", w.Hash, "sha256", "md5", "none")
+	}
+
+	if need&NeedStorage != 0 {
+		required("objectStorage.endpoint", c.ObjectStorage.Endpoint)
+		required("objectStorage.access_key", c.ObjectStorage.AccessKey)
+		required("objectStorage.secret_key", c.ObjectStorage.SecretKey)
+		required("objectStorage.bucket", c.ObjectStorage.Bucket)
+	}
+
+	nonNegative("num_threads", c.NumThreads)
+	nonNegative("concurrent_jobs", c.ConcurrentJobs)
+	duration("shutdown_grace", c.ShutdownGrace)
+	for i, tier := range c.Retry.Tiers {
+		if d, err := time.ParseDuration(tier); err != nil || d <= 0 {
+			problems = append(problems, fmt.Sprintf("retry.tiers[%d]: want a positive duration like \"30s\", got %q", i, tier))
+		}
+	}
+
+	if level := c.LogConfig().Level; level != "" {
+		var l slog.Level
+		if l.UnmarshalText([]byte(level)) != nil {
+			problems = append(problems, fmt.Sprintf("logging.level: want debug, info, warn or error, got %q", level))
+		}
+	}
+	oneOf("logging.format", c.Logging.Format, "text", "json")
+	oneOf("logging.output", c.Logging.Output, "stdout", "file", "both")
+	duration("logging.max_age", c.Logging.MaxAge)
+	nonNegative("logging.max_size_mb", c.Logging.MaxSizeMB)
+	nonNegative("logging.max_backups", c.Logging.MaxBackups)
+
+	if len(problems) > 0 {
+		return &ValidationError{Problems: problems}
+	}
+	return nil
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
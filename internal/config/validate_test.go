@@ -0,0 +1,78 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/Mwambama/KafkaSync/internal/logging"
+)
+
+func TestValidate(t *testing.T) {
+	c := Config{
+		KafkaUrl:  "localhost:9092",
+		Locations: Locations{Incompletes: "incompletes", Completes: "completes"},
+		Database:  Database{Host: "db", User: "kafkasync", DbName: "kafkasync", Port: 70000},
+		Remotes: map[string]RemoteDetails{
+			"eu-sftp": {Host: "eu.example.com", HostKeyPolicy: "sometimes", Ready: "stable", StablePolls: 1},
+			"local":   {Backend: "file", Subpath: "../outside"},
+		},
+		DefaultRemote: "eu-sftp",
+		Watch:         map[string]Watch{"inbox": {Remote: "nowhere", Interval: "soon", Include: []string{"[a-"}}},
+		Retry:         Retry{Tiers: []string{"30s", "-5m"}},
+		Logging:       logging.Config{Format: "xml"},
+		ShutdownGrace: "a while",
+	}
+	err := c.Validate(NeedKafka | NeedDatabase | NeedRemote)
+	var v *ValidationError
+	if !errors.As(err, &v) {
+		t.Fatalf("Validate = %v, want a *ValidationError", err)
+	}
+	want := []string{
+		"database.port: want 1-65535, got 70000",
+		`remotes.eu-sftp.username: required`,
+		`remotes.eu-sftp.host_key_policy: want one of strict, trust-on-first-use, insecure, got "sometimes"`,
+		`remotes.eu-sftp.stable_polls: want at least 2, got 1`,
+		`remotes.local.root: required`,
+		`remotes.local.subpath: must be a relative path inside locations, got "../outside"`,
+		`watch.inbox.location: required`,
+		`watch.inbox.remote: no remote named "nowhere"`,
+		`watch.inbox.interval: want a positive duration like "1m", got "soon"`,
+		`watch.inbox: bad glob "[a-": syntax error in pattern`,
+		`shutdown_grace: want a duration like "30s", got "a while"`,
+		`retry.tiers[1]: want a positive duration like "30s", got "-5m"`,
+		`logging.format: want one of text, json, got "xml"`,
+	}
+	if !reflect.DeepEqual(v.Problems, want) {
+		t.Errorf("problems:\n  got  %q\n  want %q", v.Problems, want)
+	}
+
+	// Sections a binary does not need are not required.
+	if err := (&Config{}).Validate(0); err != nil {
+		t.Errorf("empty config, no requirements: %v", err)
+	}
+}
+
+func TestLoadReportsProblems(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.toml")
+	os.WriteFile(path, []byte("kafka_url = \"localhost:9092\"\nkafka_uri = \"typo\"\n[database]\nport = 5432\n"), 0644)
+	t.Setenv(EnvPrefix+"DATABASE_PORT", "fifty")
+
+	c, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var v *ValidationError
+	if err := c.Validate(NeedKafka); !errors.As(err, &v) {
+		t.Fatalf("Validate = %v, want a *ValidationError", err)
+	}
+	want := []string{
+		"kafka_uri: unknown key",
+		`database.port: KAFKASYNC_DATABASE_PORT: want an integer, got "fifty"`,
+	}
+	if !reflect.DeepEqual(v.Problems, want) {
+		t.Errorf("problems = %q, want %q", v.Problems, want)
+	}
+}
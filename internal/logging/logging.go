@@ -0,0 +1,132 @@
+// Package logging sets up the log/slog logger shared by every KafkaSync
+// binary: level, text or JSON output, and stdout and/or a rotating file.
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+)
+
+// Config is the [logging] table in config.toml.
+type Config struct {
+	Level      string `toml:"level"`       // debug, info, warn, error
+	Format     string `toml:"format"`      // text or json
+	Output     string `toml:"output"`      // stdout, file or both
+	File       string `toml:"file"`        // path used when output includes file
+	MaxSizeMB  int    `toml:"max_size_mb"` // rotate once the file reaches this size
+	MaxAge     string `toml:"max_age"`     // rotate once the file is this old, e.g. "24h"
+	MaxBackups int    `toml:"max_backups"` // rotated files to keep (0 keeps all)
+}
+
+// WithDefaults fills unset fields with a binary's defaults.
+func (c Config) WithDefaults(output, file string) Config {
+	if c.Level == "" {
+		c.Level = "info"
+	}
+	if c.Format == "" {
+		c.Format = "text"
+	}
+	if c.Output == "" {
+		c.Output = output
+	}
+	if c.File == "" {
+		c.File = file
+	}
+	if c.MaxSizeMB == 0 {
+		c.MaxSizeMB = 100
+	}
+	return c
+}
+
+func parseLevel(s string) (slog.Level, error) {
+	var level slog.Level
+	err := level.UnmarshalText([]byte(s))
+	return level, err
+}
+
+// Setup builds the logger described by cfg and installs it as the slog
+// default, which also routes the standard log package through it. Any of
+// secrets appearing in a log line is masked. The returned closer flushes and
+// closes the log file, if any.
+func Setup(cfg Config, secrets ...string) (io.Closer, error) {
+	level, err := parseLevel(cfg.Level)
+	if err != nil {
+		return nil, fmt.Errorf("logging.level: %w", err)
+	}
+
+	var maxAge time.Duration
+	if cfg.MaxAge != "" {
+		if maxAge, err = time.ParseDuration(cfg.MaxAge); err != nil {
+			return nil, fmt.Errorf("logging.max_age: %w", err)
+		}
+	}
+
+	var out io.Writer
+	var closer io.Closer = nopCloser{}
+	openFile := func() (*RotatingFile, error) {
+		return OpenRotating(cfg.File, int64(cfg.MaxSizeMB)<<20, maxAge, cfg.MaxBackups)
+	}
+	switch strings.ToLower(cfg.Output) {
+	case "stdout":
+		out = os.Stdout
+	case "file":
+		f, err := openFile()
+		if err != nil {
+			return nil, err
+		}
+		out, closer = f, f
+	case "both":
+		f, err := openFile()
+		if err != nil {
+			return nil, err
+		}
+		out, closer = io.MultiWriter(os.Stdout, f), f
+	default:
+		return nil, fmt.Errorf("logging.output: want stdout, file or both, got %q", cfg.Output)
+	}
+
+	opts := &slog.HandlerOptions{Level: level}
+	var handler slog.Handler
+	switch strings.ToLower(cfg.Format) {
+	case "text":
+		handler = slog.NewTextHandler(out, opts)
+	case "json":
+		handler = slog.NewJSONHandler(out, opts)
+	default:
+		return nil, fmt.Errorf("logging.format: want text or json, got %q", cfg.Format)
+	}
+
+	slog.SetDefault(slog.New(Redact(handler, secrets...)))
+	return closer, nil
+}
+
+// Fatal logs at error level and exits, for startup failures.
+func Fatal(msg string, args ...any) {
+	slog.Error(msg, args...)
+	os.Exit(1)
+}
+
+type nopCloser struct{}
+
+func (nopCloser) Close() error { return nil }
+
+type ctxKey struct{}
+
+// NewContext returns ctx carrying logger, so code far from the Kafka loop
+// (transfer backends, uploads) logs with the job's correlation attributes.
+func NewContext(ctx context.Context, logger *slog.Logger) context.Context {
+	return context.WithValue(ctx, ctxKey{}, logger)
+}
+
+// FromContext returns the logger stored by NewContext, or the default.
+func FromContext(ctx context.Context) *slog.Logger {
+	if logger, ok := ctx.Value(ctxKey{}).(*slog.Logger); ok {
+		return logger
+	}
+	return slog.Default()
+}
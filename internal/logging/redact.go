@@ -0,0 +1,81 @@
+package logging
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+)
+
+const mask = "********"
+
+// redactHandler masks configured secrets in the message and every attribute
+// before a record reaches the real handler, so a password that ends up in an
+// error string or a command line never reaches the log.
+type redactHandler struct {
+	inner    slog.Handler
+	replacer *strings.Replacer
+}
+
+// Redact wraps h so that every occurrence of a secret is replaced. Empty
+// secrets are ignored; with none left, h is returned as is.
+func Redact(h slog.Handler, secrets ...string) slog.Handler {
+	var pairs []string
+	for _, s := range secrets {
+		if s != "" {
+			pairs = append(pairs, s, mask)
+		}
+	}
+	if len(pairs) == 0 {
+		return h
+	}
+	return &redactHandler{inner: h, replacer: strings.NewReplacer(pairs...)}
+}
+
+func (h *redactHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.inner.Enabled(ctx, level)
+}
+
+func (h *redactHandler) Handle(ctx context.Context, r slog.Record) error {
+	out := slog.NewRecord(r.Time, r.Level, h.replacer.Replace(r.Message), r.PC)
+	r.Attrs(func(a slog.Attr) bool {
+		out.AddAttrs(h.attr(a))
+		return true
+	})
+	return h.inner.Handle(ctx, out)
+}
+
+func (h *redactHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	redacted := make([]slog.Attr, len(attrs))
+	for i, a := range attrs {
+		redacted[i] = h.attr(a)
+	}
+	return &redactHandler{inner: h.inner.WithAttrs(redacted), replacer: h.replacer}
+}
+
+func (h *redactHandler) WithGroup(name string) slog.Handler {
+	return &redactHandler{inner: h.inner.WithGroup(name), replacer: h.replacer}
+}
+
+func (h *redactHandler) attr(a slog.Attr) slog.Attr {
+	v := a.Value.Resolve()
+	switch v.Kind() {
+	case slog.KindString:
+		return slog.String(a.Key, h.replacer.Replace(v.String()))
+	case slog.KindGroup:
+		group := v.Group()
+		redacted := make([]any, len(group))
+		for i, g := range group {
+			redacted[i] = h.attr(g)
+		}
+		return slog.Group(a.Key, redacted...)
+	case slog.KindAny:
+		// Errors, Stringers and structs are rendered the way the handler
+		// would, and only replaced when they actually contain a secret.
+		s := fmt.Sprint(v.Any())
+		if r := h.replacer.Replace(s); r != s {
+			return slog.String(a.Key, r)
+		}
+	}
+	return slog.Attr{Key: a.Key, Value: v}
+}
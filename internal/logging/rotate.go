@@ -0,0 +1,157 @@
+package logging
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RotatingFile is an append-only log file that is rotated aside once it
+// grows past maxSize or gets older than maxAge. Rotated files are named
+// <file>.<timestamp> and only the newest maxBackups are kept.
+type RotatingFile struct {
+	path       string
+	maxSize    int64
+	maxAge     time.Duration
+	maxBackups int
+
+	mu      sync.Mutex
+	file    *os.File
+	size    int64
+	created time.Time
+	stuck   time.Time // when rotating last failed
+}
+
+// rotateRetry is how long after a failed rotation the next one is tried.
+// Until then, lines keep going to the current file.
+const rotateRetry = time.Minute
+
+const backupTimeFormat = "2006-01-02T15-04-05.000"
+
+func OpenRotating(path string, maxSize int64, maxAge time.Duration, maxBackups int) (*RotatingFile, error) {
+	r := &RotatingFile{path: path, maxSize: maxSize, maxAge: maxAge, maxBackups: maxBackups}
+	if err := r.open(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *RotatingFile) open() error {
+	if dir := filepath.Dir(r.path); dir != "." {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+	}
+	f, err := os.OpenFile(r.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	r.file, r.size = f, info.Size()
+	// Files don't record a creation time portably; the last write is the
+	// best stand-in for an existing file and keeps restarts from resetting
+	// the age clock.
+	r.created = time.Now()
+	if info.Size() > 0 {
+		r.created = info.ModTime()
+	}
+	return nil
+}
+
+func (r *RotatingFile) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.due(int64(len(p))) {
+		if err := r.rotate(); err != nil {
+			if r.file == nil {
+				return 0, err
+			}
+			// Better an oversized file than no log at all.
+			r.stuck = time.Now()
+			fmt.Fprintf(os.Stderr, "log rotation failed, still writing to %s: %v\n", r.path, err)
+		}
+	}
+	n, err := r.file.Write(p)
+	r.size += int64(n)
+	return n, err
+}
+
+func (r *RotatingFile) due(incoming int64) bool {
+	if r.size == 0 || time.Since(r.stuck) < rotateRetry {
+		return false
+	}
+	if r.maxSize > 0 && r.size+incoming > r.maxSize {
+		return true
+	}
+	return r.maxAge > 0 && time.Since(r.created) > r.maxAge
+}
+
+// rotate moves the file aside and starts a new one. If the rename fails the
+// original path is reopened, so r.file is nil only when that fails too.
+func (r *RotatingFile) rotate() error {
+	// Closed first: Windows will not rename an open file.
+	if err := r.file.Close(); err != nil {
+		return r.reopen(err)
+	}
+	backup := r.path + "." + time.Now().Format(backupTimeFormat)
+	if err := os.Rename(r.path, backup); err != nil {
+		return r.reopen(err)
+	}
+	if err := r.open(); err != nil {
+		r.file = nil
+		return err
+	}
+	r.prune()
+	return nil
+}
+
+// reopen opens the log path again after a failed rotation and returns err.
+func (r *RotatingFile) reopen(err error) error {
+	if openErr := r.open(); openErr != nil {
+		r.file = nil
+		return errors.Join(err, openErr)
+	}
+	return err
+}
+
+// prune deletes the oldest backups beyond maxBackups.
+func (r *RotatingFile) prune() {
+	if r.maxBackups <= 0 {
+		return
+	}
+	backups, err := filepath.Glob(r.path + ".*")
+	if err != nil {
+		return
+	}
+	var ours []string
+	for _, b := range backups {
+		stamp := strings.TrimPrefix(b, r.path+".")
+		if _, err := time.Parse(backupTimeFormat, stamp); err == nil {
+			ours = append(ours, b)
+		}
+	}
+	sort.Strings(ours) // timestamps sort chronologically
+	for len(ours) > r.maxBackups {
+		os.Remove(ours[0])
+		ours = ours[1:]
+	}
+}
+
+func (r *RotatingFile) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.file == nil {
+		return nil
+	}
+	return r.file.Close()
+}
@@ -0,0 +1,264 @@
+// Package metrics is a small Prometheus text-format exporter, enough for
+// counters, gauges and histograms without pulling in client_golang.
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Registry owns a set of metrics and renders them for /metrics.
+type Registry struct {
+	mu       sync.Mutex
+	families []family
+	onScrape []func()
+}
+
+type family interface {
+	write(w io.Writer)
+}
+
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+func (r *Registry) register(f family) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.families = append(r.families, f)
+}
+
+// OnScrape runs fn before every scrape, e.g. to pull stats from a client
+// that only hands them out on request.
+func (r *Registry) OnScrape(fn func()) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.onScrape = append(r.onScrape, fn)
+}
+
+// Write renders every metric in the Prometheus text exposition format.
+func (r *Registry) Write(w io.Writer) {
+	r.mu.Lock()
+	hooks := append([]func(){}, r.onScrape...)
+	families := append([]family{}, r.families...)
+	r.mu.Unlock()
+
+	for _, fn := range hooks {
+		fn()
+	}
+	for _, f := range families {
+		f.write(w)
+	}
+}
+
+// Handler serves the registry.
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		r.Write(w)
+	})
+}
+
+// vec keeps one value per label combination.
+type vec struct {
+	name, help, kind string
+	labels           []string
+
+	mu     sync.Mutex
+	values map[string]float64 // keyed by rendered label set
+}
+
+func newVec(name, help, kind string, labels []string) *vec {
+	return &vec{name: name, help: help, kind: kind, labels: labels, values: map[string]float64{}}
+}
+
+func (v *vec) key(values []string) string {
+	if len(values) != len(v.labels) {
+		panic(fmt.Sprintf("metrics: %s wants %d label values, got %d", v.name, len(v.labels), len(values)))
+	}
+	return renderLabels(v.labels, values)
+}
+
+func (v *vec) add(delta float64, values []string) {
+	k := v.key(values)
+	v.mu.Lock()
+	v.values[k] += delta
+	v.mu.Unlock()
+}
+
+func (v *vec) set(val float64, values []string) {
+	k := v.key(values)
+	v.mu.Lock()
+	v.values[k] = val
+	v.mu.Unlock()
+}
+
+func (v *vec) write(w io.Writer) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	writeHeader(w, v.name, v.help, v.kind)
+	keys := make([]string, 0, len(v.values))
+	for k := range v.values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		fmt.Fprintf(w, "%s%s %s\n", v.name, k, formatFloat(v.values[k]))
+	}
+}
+
+// CounterVec is a counter partitioned by labels.
+type CounterVec struct{ v *vec }
+
+func (r *Registry) NewCounterVec(name, help string, labels ...string) *CounterVec {
+	c := &CounterVec{v: newVec(name, help, "counter", labels)}
+	r.register(c.v)
+	return c
+}
+
+func (c *CounterVec) Inc(labels ...string) { c.v.add(1, labels) }
+
+func (c *CounterVec) Add(delta float64, labels ...string) {
+	if delta < 0 {
+		panic("metrics: counters cannot decrease")
+	}
+	c.v.add(delta, labels)
+}
+
+// Counter is a counter without labels.
+type Counter struct{ v *vec }
+
+func (r *Registry) NewCounter(name, help string) *Counter {
+	c := &Counter{v: newVec(name, help, "counter", nil)}
+	c.v.values[""] = 0
+	r.register(c.v)
+	return c
+}
+
+func (c *Counter) Add(delta float64) {
+	if delta < 0 {
+		panic("metrics: counters cannot decrease")
+	}
+	c.v.add(delta, nil)
+}
+
+// GaugeVec is a gauge partitioned by labels.
+type GaugeVec struct{ v *vec }
+
+func (r *Registry) NewGaugeVec(name, help string, labels ...string) *GaugeVec {
+	g := &GaugeVec{v: newVec(name, help, "gauge", labels)}
+	r.register(g.v)
+	return g
+}
+
+func (g *GaugeVec) Inc(labels ...string)              { g.v.add(1, labels) }
+func (g *GaugeVec) Dec(labels ...string)              { g.v.add(-1, labels) }
+func (g *GaugeVec) Set(val float64, labels ...string) { g.v.set(val, labels) }
+
+// Gauge is a gauge without labels.
+type Gauge struct{ v *vec }
+
+func (r *Registry) NewGauge(name, help string) *Gauge {
+	g := &Gauge{v: newVec(name, help, "gauge", nil)}
+	g.v.values[""] = 0
+	r.register(g.v)
+	return g
+}
+
+func (g *Gauge) Inc()            { g.v.add(1, nil) }
+func (g *Gauge) Dec()            { g.v.add(-1, nil) }
+func (g *Gauge) Set(val float64) { g.v.set(val, nil) }
+
+// Histogram counts observations into cumulative buckets.
+type Histogram struct {
+	name, help string
+	buckets    []float64
+
+	mu     sync.Mutex
+	counts []uint64 // per bucket, not cumulative; last slot is +Inf
+	sum    float64
+	count  uint64
+}
+
+func (r *Registry) NewHistogram(name, help string, buckets []float64) *Histogram {
+	b := append([]float64{}, buckets...)
+	sort.Float64s(b)
+	h := &Histogram{name: name, help: help, buckets: b, counts: make([]uint64, len(b)+1)}
+	r.register(h)
+	return h
+}
+
+func (h *Histogram) Observe(val float64) {
+	i := sort.SearchFloat64s(h.buckets, val)
+	h.mu.Lock()
+	h.counts[i]++
+	h.sum += val
+	h.count++
+	h.mu.Unlock()
+}
+
+func (h *Histogram) write(w io.Writer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	writeHeader(w, h.name, h.help, "histogram")
+	var cumulative uint64
+	for i, upper := range h.buckets {
+		cumulative += h.counts[i]
+		fmt.Fprintf(w, "%s_bucket{le=\"%s\"} %d\n", h.name, formatFloat(upper), cumulative)
+	}
+	fmt.Fprintf(w, "%s_bucket{le=\"+Inf\"} %d\n", h.name, h.count)
+	fmt.Fprintf(w, "%s_sum %s\n", h.name, formatFloat(h.sum))
+	fmt.Fprintf(w, "%s_count %d\n", h.name, h.count)
+}
+
+// ExponentialBuckets returns count buckets starting at start, each factor
+// times the previous one.
+func ExponentialBuckets(start, factor float64, count int) []float64 {
+	b := make([]float64, count)
+	for i := range b {
+		b[i] = start
+		start *= factor
+	}
+	return b
+}
+
+func writeHeader(w io.Writer, name, help, kind string) {
+	fmt.Fprintf(w, "# HELP %s %s\n", name, strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(help))
+	fmt.Fprintf(w, "# TYPE %s %s\n", name, kind)
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func renderLabels(names, values []string) string {
+	if len(names) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteByte('{')
+	for i, n := range names {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		fmt.Fprintf(&b, "%s=\"%s\"", n, labelEscaper.Replace(values[i]))
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+func formatFloat(f float64) string {
+	switch {
+	case math.IsInf(f, 1):
+		return "+Inf"
+	case math.IsInf(f, -1):
+		return "-Inf"
+	case math.IsNaN(f):
+		return "NaN"
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
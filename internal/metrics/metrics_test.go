@@ -0,0 +1,67 @@
+package metrics
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestWrite(t *testing.T) {
+	r := NewRegistry()
+	jobs := r.NewCounterVec("jobs_total", "Jobs finished, by final status.", "status", "remote")
+	fetched := r.NewCounter("fetches_total", `Fetches, counted with a \ and a
+newline in the help.`)
+	inFlight := r.NewGauge("in_flight", "Jobs running.")
+	seconds := r.NewHistogram("download_seconds", "Download time.", []float64{1, 0.5, 2})
+
+	jobs.Inc("FAILED", "eu")
+	jobs.Add(2, "COMPLETED_AND_UPLOADED", "eu")
+	jobs.Inc(`say "hi"`+"\n"+`C:\in`, "us")
+	fetched.Add(3)
+	inFlight.Inc()
+	inFlight.Inc()
+	inFlight.Dec()
+	for _, v := range []float64{0.25, 0.5, 1.5, 5} {
+		seconds.Observe(v)
+	}
+	scraped := 0
+	r.OnScrape(func() { scraped++ })
+
+	want := `# HELP jobs_total Jobs finished, by final status.
+# TYPE jobs_total counter
+jobs_total{status="COMPLETED_AND_UPLOADED",remote="eu"} 2
+jobs_total{status="FAILED",remote="eu"} 1
+jobs_total{status="say \"hi\"\nC:\\in",remote="us"} 1
+# HELP fetches_total Fetches, counted with a \\ and a\nnewline in the help.
+# TYPE fetches_total counter
+fetches_total 3
+# HELP in_flight Jobs running.
+# TYPE in_flight gauge
+in_flight 1
+# HELP download_seconds Download time.
+# TYPE download_seconds histogram
+download_seconds_bucket{le="0.5"} 2
+download_seconds_bucket{le="1"} 2
+download_seconds_bucket{le="2"} 3
+download_seconds_bucket{le="+Inf"} 4
+download_seconds_sum 7.25
+download_seconds_count 4
+`
+	var out bytes.Buffer
+	r.Write(&out)
+	if got := out.String(); got != want {
+		t.Errorf("Write:\n%s\nwant:\n%s", got, want)
+	}
+	if scraped != 1 {
+		t.Errorf("OnScrape hook ran %d times, want 1", scraped)
+	}
+
+	rec := httptest.NewRecorder()
+	r.Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	if ct := rec.Header().Get("Content-Type"); ct != "text/plain; version=0.0.4; charset=utf-8" {
+		t.Errorf("Content-Type = %q", ct)
+	}
+	if rec.Body.String() != want {
+		t.Errorf("handler body differs from Write:\n%s", rec.Body.String())
+	}
+}
@@ -0,0 +1,324 @@
+// Package migrate applies the versioned SQL files in migrations/ and tracks
+// them in the schema_migrations table.
+package migrate
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"embed"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//go:embed migrations/*.sql
+var files embed.FS
+
+// lockID serialises concurrent `migrate` runs via pg_advisory_lock.
+const lockID = 7402117
+
+// Migration is one numbered schema change, e.g. 0004_create_jobs.
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// Checksum identifies the migration's up script, so an applied migration
+// whose file was edited afterwards can be told apart.
+func (m Migration) Checksum() string {
+	sum := sha256.Sum256([]byte(m.Up))
+	return hex.EncodeToString(sum[:])
+}
+
+// State is a migration and whether (and when) it has been applied.
+type State struct {
+	Migration
+	Applied   bool
+	AppliedAt time.Time
+	Modified  bool // applied from an up script that has changed since
+}
+
+// ErrBehind is returned by Check when migrations are pending.
+type ErrBehind struct {
+	Current, Latest int
+}
+
+func (e *ErrBehind) Error() string {
+	return fmt.Sprintf("database schema is at version %d but version %d is required; run `kafkasync migrate up`", e.Current, e.Latest)
+}
+
+// ErrModified is returned by Check when an applied migration's file no
+// longer matches what was run.
+type ErrModified struct {
+	Version int
+	Name    string
+}
+
+func (e *ErrModified) Error() string {
+	return fmt.Sprintf("migration %04d_%s was changed after it was applied; restore the file and add a new migration instead", e.Version, e.Name)
+}
+
+// All returns the embedded migrations in version order.
+func All() ([]Migration, error) {
+	return load(files)
+}
+
+// load reads the migrations under migrations/ in fsys.
+func load(fsys fs.FS) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, "migrations")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := map[int]*Migration{}
+	for _, e := range entries {
+		name := e.Name()
+		base, direction, ok := strings.Cut(strings.TrimSuffix(name, ".sql"), ".")
+		if !ok || (direction != "up" && direction != "down") {
+			return nil, fmt.Errorf("migration %s: want NNNN_name.up.sql or NNNN_name.down.sql", name)
+		}
+		num, label, _ := strings.Cut(base, "_")
+		version, err := strconv.Atoi(num)
+		if err != nil || version <= 0 {
+			return nil, fmt.Errorf("migration %s: bad version number", name)
+		}
+
+		body, err := fs.ReadFile(fsys, path.Join("migrations", name))
+		if err != nil {
+			return nil, err
+		}
+		m, seen := byVersion[version]
+		if !seen {
+			m = &Migration{Version: version, Name: label}
+			byVersion[version] = m
+		} else if m.Name != label {
+			return nil, fmt.Errorf("migration version %d used by both %q and %q", version, m.Name, label)
+		}
+		if direction == "up" {
+			m.Up = string(body)
+		} else {
+			m.Down = string(body)
+		}
+	}
+
+	all := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" {
+			return nil, fmt.Errorf("migration %04d_%s has no .up.sql", m.Version, m.Name)
+		}
+		all = append(all, *m)
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].Version < all[j].Version })
+	return all, nil
+}
+
+// Latest is the highest embedded version, i.e. what the binaries expect.
+func Latest() int {
+	all, err := All()
+	if err != nil || len(all) == 0 {
+		return 0
+	}
+	return all[len(all)-1].Version
+}
+
+func ensureTable(db *sql.DB) error {
+	_, err := db.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (
+		version INTEGER PRIMARY KEY,
+		name TEXT NOT NULL,
+		applied_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+	)`)
+	if err != nil {
+		return err
+	}
+	// Tables from before checksums were kept have none for what they ran.
+	_, err = db.Exec(`ALTER TABLE schema_migrations ADD COLUMN IF NOT EXISTS checksum TEXT`)
+	return err
+}
+
+// record is a row of schema_migrations.
+type record struct {
+	at       time.Time
+	checksum string // "" when applied before checksums were kept
+}
+
+func applied(db *sql.DB) (map[int]record, error) {
+	rows, err := db.Query(`SELECT version, applied_at, COALESCE(checksum, '') FROM schema_migrations`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	done := map[int]record{}
+	for rows.Next() {
+		var v int
+		var r record
+		if err := rows.Scan(&v, &r.at, &r.checksum); err != nil {
+			return nil, err
+		}
+		done[v] = r
+	}
+	return done, rows.Err()
+}
+
+// Status lists every embedded migration with its applied state.
+func Status(db *sql.DB) ([]State, error) {
+	all, err := All()
+	if err != nil {
+		return nil, err
+	}
+	if err := ensureTable(db); err != nil {
+		return nil, err
+	}
+	done, err := applied(db)
+	if err != nil {
+		return nil, err
+	}
+	return states(all, done), nil
+}
+
+func states(all []Migration, done map[int]record) []State {
+	states := make([]State, len(all))
+	for i, m := range all {
+		r, ok := done[m.Version]
+		states[i] = State{Migration: m, Applied: ok, AppliedAt: r.at, Modified: ok && r.checksum != "" && r.checksum != m.Checksum()}
+	}
+	return states
+}
+
+// Check returns *ErrModified if an applied migration was edited since, and
+// *ErrBehind if any embedded migration has not been applied. The consumer
+// and server call it at startup instead of creating tables.
+func Check(db *sql.DB) error {
+	states, err := Status(db)
+	if err != nil {
+		return err
+	}
+	return check(states)
+}
+
+func check(states []State) error {
+	current, pending := 0, false
+	for _, s := range states {
+		if s.Modified {
+			return &ErrModified{Version: s.Version, Name: s.Name}
+		}
+		if s.Applied {
+			current = s.Version
+		} else {
+			pending = true
+		}
+	}
+	if pending {
+		latest := 0
+		if len(states) > 0 {
+			latest = states[len(states)-1].Version
+		}
+		return &ErrBehind{Current: current, Latest: latest}
+	}
+	return nil
+}
+
+// Up applies every pending migration in order, each in its own
+// transaction, and returns the ones it ran.
+func Up(db *sql.DB) ([]Migration, error) {
+	unlock, err := lock(db)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	states, err := Status(db)
+	if err != nil {
+		return nil, err
+	}
+	var ran []Migration
+	for _, s := range states {
+		if s.Applied {
+			continue
+		}
+		err := inTx(db, func(tx *sql.Tx) error {
+			if _, err := tx.Exec(s.Up); err != nil {
+				return err
+			}
+			_, err := tx.Exec(`INSERT INTO schema_migrations (version, name, checksum) VALUES ($1, $2, $3)`, s.Version, s.Name, s.Checksum())
+			return err
+		})
+		if err != nil {
+			return ran, fmt.Errorf("migration %04d_%s: %w", s.Version, s.Name, err)
+		}
+		ran = append(ran, s.Migration)
+	}
+	return ran, nil
+}
+
+// Down rolls back the most recent `steps` applied migrations.
+func Down(db *sql.DB, steps int) ([]Migration, error) {
+	unlock, err := lock(db)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	states, err := Status(db)
+	if err != nil {
+		return nil, err
+	}
+	var undone []Migration
+	for i := len(states) - 1; i >= 0 && len(undone) < steps; i-- {
+		s := states[i]
+		if !s.Applied {
+			continue
+		}
+		if s.Down == "" {
+			return undone, fmt.Errorf("migration %04d_%s has no .down.sql", s.Version, s.Name)
+		}
+		err := inTx(db, func(tx *sql.Tx) error {
+			if _, err := tx.Exec(s.Down); err != nil {
+				return err
+			}
+			_, err := tx.Exec(`DELETE FROM schema_migrations WHERE version = $1`, s.Version)
+			return err
+		})
+		if err != nil {
+			return undone, fmt.Errorf("migration %04d_%s: %w", s.Version, s.Name, err)
+		}
+		undone = append(undone, s.Migration)
+	}
+	return undone, nil
+}
+
+func inTx(db *sql.DB, fn func(*sql.Tx) error) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// lock takes a session-level advisory lock on a dedicated connection so two
+// operators running migrate at once cannot interleave.
+func lock(db *sql.DB) (func(), error) {
+	conn, err := db.Conn(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	if _, err := conn.ExecContext(context.Background(), `SELECT pg_advisory_lock($1)`, lockID); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return func() {
+		conn.ExecContext(context.Background(), `SELECT pg_advisory_unlock($1)`, lockID)
+		conn.Close()
+	}, nil
+}
@@ -0,0 +1,120 @@
+package migrate
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func sqlFiles(names ...string) fstest.MapFS {
+	fsys := fstest.MapFS{}
+	for _, name := range names {
+		fsys["migrations/"+name] = &fstest.MapFile{Data: []byte("-- " + name)}
+	}
+	return fsys
+}
+
+func TestLoad(t *testing.T) {
+	// Directory order is by name, so 10 sorts before 2; load sorts by number.
+	all, err := load(sqlFiles(
+		"0010_ten.up.sql", "0002_two.up.sql", "0002_two.down.sql",
+		"0001_one.up.sql", "0001_one.down.sql",
+	))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, m := range all {
+		got = append(got, m.Name)
+	}
+	if strings.Join(got, ",") != "one,two,ten" {
+		t.Errorf("order = %v, want one, two, ten", got)
+	}
+	if all[1].Up != "-- 0002_two.up.sql" || all[1].Down != "-- 0002_two.down.sql" || all[2].Down != "" {
+		t.Errorf("scripts = %+v", all)
+	}
+
+	rejected := []struct {
+		files []string
+		want  string
+	}{
+		{[]string{"0001_one.sql"}, "want NNNN_name.up.sql"},
+		{[]string{"0001_one.sideways.sql"}, "want NNNN_name.up.sql"},
+		{[]string{"abcd_one.up.sql"}, "bad version number"},
+		{[]string{"0000_zero.up.sql"}, "bad version number"},
+		{[]string{"0001_one.up.sql", "0001_uno.up.sql"}, "used by both"},
+		{[]string{"0001_one.down.sql"}, "has no .up.sql"},
+	}
+	for _, r := range rejected {
+		if _, err := load(sqlFiles(r.files...)); err == nil || !strings.Contains(err.Error(), r.want) {
+			t.Errorf("load(%v) = %v, want an error containing %q", r.files, err, r.want)
+		}
+	}
+}
+
+// The embedded migrations themselves load, and Latest is the last of them.
+func TestAll(t *testing.T) {
+	all, err := All()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, m := range all {
+		if m.Version != i+1 {
+			t.Errorf("migration %d is %04d_%s, want versions without gaps", i, m.Version, m.Name)
+		}
+		if m.Down == "" {
+			t.Errorf("%04d_%s has no .down.sql", m.Version, m.Name)
+		}
+	}
+	if Latest() != all[len(all)-1].Version {
+		t.Errorf("Latest = %d, want %d", Latest(), all[len(all)-1].Version)
+	}
+}
+
+func TestCheck(t *testing.T) {
+	all := []Migration{{Version: 1, Name: "one", Up: "CREATE TABLE a ()"}, {Version: 2, Name: "two", Up: "CREATE TABLE b ()"}}
+	at := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	applied := func(m Migration) record { return record{at: at, checksum: m.Checksum()} }
+
+	cases := []struct {
+		name         string
+		done         map[int]record
+		wantBehind   *ErrBehind
+		wantModified int // version, 0 for none
+	}{
+		{"up to date", map[int]record{1: applied(all[0]), 2: applied(all[1])}, nil, 0},
+		{"one pending", map[int]record{1: applied(all[0])}, &ErrBehind{Current: 1, Latest: 2}, 0},
+		{"fresh database", map[int]record{}, &ErrBehind{Current: 0, Latest: 2}, 0},
+		{"applied before checksums", map[int]record{1: {at: at}, 2: {at: at}}, nil, 0},
+		{"edited after it ran", map[int]record{1: {at: at, checksum: Migration{Up: "CREATE TABLE a (id INT)"}.Checksum()}, 2: applied(all[1])}, nil, 1},
+		{"edited and behind", map[int]record{2: {at: at, checksum: "0000"}}, nil, 2},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			s := states(all, c.done)
+			err := check(s)
+
+			var behind *ErrBehind
+			var modified *ErrModified
+			switch {
+			case c.wantModified != 0:
+				if !errors.As(err, &modified) || modified.Version != c.wantModified {
+					t.Errorf("Check = %v, want migration %d reported as modified", err, c.wantModified)
+				}
+			case c.wantBehind != nil:
+				if !errors.As(err, &behind) || *behind != *c.wantBehind {
+					t.Errorf("Check = %v, want %+v", err, c.wantBehind)
+				}
+			case err != nil:
+				t.Errorf("Check = %v, want nil", err)
+			}
+			for _, st := range s {
+				if _, ok := c.done[st.Version]; ok != st.Applied || ok && !st.AppliedAt.Equal(at) {
+					t.Errorf("state %d = %+v, want applied %v at %v", st.Version, st, ok, at)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,9 @@
+-- Baseline: the table the consumer used to create on startup.
+CREATE TABLE IF NOT EXISTS downloads (
+	id SERIAL PRIMARY KEY,
+	filename TEXT NOT NULL,
+	remote_location TEXT,
+	hash TEXT,
+	status TEXT,
+	downloaded_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
@@ -0,0 +1 @@
+ALTER TABLE downloads ADD COLUMN IF NOT EXISTS attempt INTEGER NOT NULL DEFAULT 1;
@@ -0,0 +1 @@
+DROP INDEX IF EXISTS downloads_completed_idx;
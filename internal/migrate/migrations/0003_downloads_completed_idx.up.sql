@@ -0,0 +1,2 @@
+CREATE INDEX IF NOT EXISTS downloads_completed_idx
+	ON downloads (remote_location, filename, hash) WHERE status = 'COMPLETED_AND_UPLOADED';
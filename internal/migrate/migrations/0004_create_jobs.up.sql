@@ -0,0 +1,23 @@
+CREATE TABLE IF NOT EXISTS jobs (
+	job_id TEXT PRIMARY KEY,
+	filename TEXT NOT NULL,
+	remote_location TEXT,
+	hash TEXT,
+	state TEXT NOT NULL,
+	status TEXT,
+	attempt INTEGER NOT NULL DEFAULT 1,
+	created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS job_events (
+	id BIGSERIAL PRIMARY KEY,
+	job_id TEXT NOT NULL REFERENCES jobs (job_id),
+	state TEXT NOT NULL,
+	attempt INTEGER NOT NULL,
+	detail TEXT,
+	created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS job_events_job_idx ON job_events (job_id, id);
+CREATE INDEX IF NOT EXISTS jobs_state_idx ON jobs (state);
@@ -0,0 +1,14 @@
+DROP INDEX IF EXISTS downloads_job_idx;
+
+ALTER TABLE downloads
+	DROP COLUMN IF EXISTS job_id,
+	DROP COLUMN IF EXISTS size_bytes,
+	DROP COLUMN IF EXISTS download_ms,
+	DROP COLUMN IF EXISTS upload_ms,
+	DROP COLUMN IF EXISTS throughput_bps,
+	DROP COLUMN IF EXISTS error,
+	DROP COLUMN IF EXISTS kafka_topic,
+	DROP COLUMN IF EXISTS kafka_partition,
+	DROP COLUMN IF EXISTS kafka_offset,
+	DROP COLUMN IF EXISTS message_time,
+	DROP COLUMN IF EXISTS consumer_id;
@@ -0,0 +1,14 @@
+ALTER TABLE downloads
+	ADD COLUMN IF NOT EXISTS job_id TEXT,
+	ADD COLUMN IF NOT EXISTS size_bytes BIGINT,
+	ADD COLUMN IF NOT EXISTS download_ms BIGINT,
+	ADD COLUMN IF NOT EXISTS upload_ms BIGINT,
+	ADD COLUMN IF NOT EXISTS throughput_bps DOUBLE PRECISION,
+	ADD COLUMN IF NOT EXISTS error TEXT,
+	ADD COLUMN IF NOT EXISTS kafka_topic TEXT,
+	ADD COLUMN IF NOT EXISTS kafka_partition INTEGER,
+	ADD COLUMN IF NOT EXISTS kafka_offset BIGINT,
+	ADD COLUMN IF NOT EXISTS message_time TIMESTAMPTZ,
+	ADD COLUMN IF NOT EXISTS consumer_id TEXT;
+
+CREATE INDEX IF NOT EXISTS downloads_job_idx ON downloads (job_id);
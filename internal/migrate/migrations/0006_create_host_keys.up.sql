@@ -0,0 +1,7 @@
+-- Host keys accepted by the trust-on-first-use policy, one per remote host.
+CREATE TABLE IF NOT EXISTS host_keys (
+	host TEXT PRIMARY KEY,
+	key_type TEXT NOT NULL,
+	fingerprint TEXT NOT NULL,
+	first_seen TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+);
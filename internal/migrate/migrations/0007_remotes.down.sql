@@ -0,0 +1,2 @@
+ALTER TABLE jobs DROP COLUMN IF EXISTS remote;
+ALTER TABLE downloads DROP COLUMN IF EXISTS remote;
@@ -0,0 +1,3 @@
+-- Rows from before named remotes stay NULL and are read as "default".
+ALTER TABLE downloads ADD COLUMN IF NOT EXISTS remote TEXT;
+ALTER TABLE jobs ADD COLUMN IF NOT EXISTS remote TEXT;
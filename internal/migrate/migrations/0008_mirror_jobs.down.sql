@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS jobs_parent_idx;
+ALTER TABLE jobs DROP COLUMN IF EXISTS parent_id;
@@ -0,0 +1,3 @@
+-- Files of a mirror job are jobs of their own, pointing at the mirror.
+ALTER TABLE jobs ADD COLUMN IF NOT EXISTS parent_id TEXT;
+CREATE INDEX IF NOT EXISTS jobs_parent_idx ON jobs (parent_id) WHERE parent_id IS NOT NULL;
@@ -0,0 +1,12 @@
+-- What `kafkasync watch` last published for each file, so a restart does
+-- not publish everything again.
+CREATE TABLE IF NOT EXISTS watched_files (
+	watch TEXT NOT NULL,
+	path TEXT NOT NULL,
+	size_bytes BIGINT,
+	mtime TIMESTAMPTZ,
+	hash TEXT,
+	job_id TEXT,
+	published_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+	PRIMARY KEY (watch, path)
+);
@@ -0,0 +1,83 @@
+// Package model holds the types that cross a process boundary: the Kafka
+// message the producer sends the consumer, and the rows the consumer writes
+// and the API server reads back.
+package model
+
+import (
+	"encoding/json"
+	"net/url"
+	"path"
+)
+
+// DownloadNotification is the payload of a message on kafkasync-files.
+type DownloadNotification struct {
+	JobID    string `json:"job_id,omitempty"`
+	Hash     string `json:"info_hash"`
+	Name     string `json:"name"`
+	Location string `json:"location"`
+	Force    bool   `json:"force,omitempty"`  // re-download even if already archived
+	Remote   string `json:"remote,omitempty"` // [remotes.<name>] to fetch from, empty for the default
+	// Source is a full URI such as ftps://host/dir/file or s3://bucket/key.
+	// When set it replaces Location, and Name may be left out.
+	Source string `json:"source,omitempty"`
+
+	// Mirror fetches the directory at Location/Name (or Source) and
+	// everything under it instead of a single file. Include and Exclude are
+	// path.Match globs; a pattern without a slash matches file names, one
+	// with a slash the path relative to the directory. Files are uploaded
+	// under Prefix, or under the directory's own name when it is empty.
+	Mirror  bool     `json:"mirror,omitempty"`
+	Include []string `json:"include,omitempty"`
+	Exclude []string `json:"exclude,omitempty"`
+	Prefix  string   `json:"prefix,omitempty"`
+}
+
+// FileName is Name, or the last element of the source path when only a
+// source was given. A mirror of Location with no Name is named after the
+// directory.
+func (n DownloadNotification) FileName() string {
+	if n.Name != "" {
+		return n.Name
+	}
+	if n.Source != "" {
+		if u, err := url.Parse(n.Source); err == nil && u.Path != "" {
+			return path.Base(u.Path)
+		}
+		return ""
+	}
+	if n.Mirror && n.Location != "" {
+		return path.Base(n.Location)
+	}
+	return ""
+}
+
+// Origin is where the file comes from, as recorded in remote_location: the
+// source URI if there is one, otherwise Location.
+func (n DownloadNotification) Origin() string {
+	if n.Source != "" {
+		return n.Source
+	}
+	return n.Location
+}
+
+// Key is the Kafka message key. Keying on the file name keeps every job for
+// the same file on one partition, in order, as long as writers balance by
+// key (kafka.Hash). The remote is left out on
+// purpose: remotes may share local directories, so two jobs for the same
+// name must not run at once even when they come from different servers.
+func (n DownloadNotification) Key() []byte {
+	return []byte(n.FileName())
+}
+
+// Encode returns the wire form of n.
+func (n DownloadNotification) Encode() ([]byte, error) {
+	return json.Marshal(n)
+}
+
+// DecodeNotification parses a message value. Unknown fields are ignored so
+// newer producers can add fields without breaking older consumers.
+func DecodeNotification(value []byte) (DownloadNotification, error) {
+	var n DownloadNotification
+	err := json.Unmarshal(value, &n)
+	return n, err
+}
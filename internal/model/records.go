@@ -0,0 +1,95 @@
+package model
+
+import "time"
+
+// Job lifecycle states. A job moves forward through the pipeline and ends
+// in DONE or FAILED, or in DEFERRED when its file is not ready yet; a retry
+// or redelivery starts it again at RECEIVED.
+const (
+	StateReceived    = "RECEIVED"
+	StateMirroring   = "MIRRORING" // a mirror job while its files run
+	StateDownloading = "DOWNLOADING"
+	StateVerifying   = "VERIFYING"
+	StateMoving      = "MOVING"
+	StateUploading   = "UPLOADING"
+	StateDone        = "DONE"
+	StateFailed      = "FAILED"
+	StateDeferred    = "DEFERRED"
+)
+
+// Download is one attempt at a job, as the consumer records it in the
+// downloads table. Zero metrics are stored as NULL.
+type Download struct {
+	JobID        string
+	Remote       string // resolved remote name, never empty
+	Notification DownloadNotification
+	Status       string
+	Attempt      int
+	Err          error
+
+	Size         int64
+	DownloadTime time.Duration
+	UploadTime   time.Duration
+
+	KafkaTopic     string
+	KafkaPartition int
+	KafkaOffset    int64
+	MessageTime    time.Time
+	ConsumerID     string
+}
+
+// DownloadRecord is a downloads row as the API serves it. Transfer and Kafka
+// fields are null on rows written before they existed or for stages a job
+// never reached.
+type DownloadRecord struct {
+	ID             int      `json:"id"`
+	JobID          *string  `json:"job_id"`
+	Remote         string   `json:"remote"`
+	Filename       string   `json:"filename"`
+	RemoteLocation string   `json:"remote_location"`
+	Hash           string   `json:"hash"`
+	Status         string   `json:"status"`
+	Attempt        int      `json:"attempt"`
+	Error          *string  `json:"error"`
+	SizeBytes      *int64   `json:"size_bytes"`
+	DownloadMs     *int64   `json:"download_ms"`
+	UploadMs       *int64   `json:"upload_ms"`
+	ThroughputBps  *float64 `json:"throughput_bps"`
+	KafkaTopic     *string  `json:"kafka_topic"`
+	KafkaPartition *int     `json:"kafka_partition"`
+	KafkaOffset    *int64   `json:"kafka_offset"`
+	MessageTime    *string  `json:"message_time"`
+	ConsumerID     *string  `json:"consumer_id"`
+	DownloadedAt   string   `json:"downloaded_at"`
+}
+
+// JobRecord is a row of jobs: where a job currently is.
+type JobRecord struct {
+	JobID          string `json:"job_id"`
+	Remote         string `json:"remote"`
+	Filename       string `json:"filename"`
+	RemoteLocation string `json:"remote_location"`
+	Hash           string `json:"hash"`
+	State          string `json:"state"`
+	Status         string `json:"status"`
+	Attempt        int    `json:"attempt"`
+	ParentID       string `json:"parent_id,omitempty"` // the mirror job this file belongs to
+	CreatedAt      string `json:"created_at"`
+	UpdatedAt      string `json:"updated_at"`
+}
+
+// JobEvent is a row of job_events: one state a job passed through.
+type JobEvent struct {
+	State   string    `json:"state"`
+	Attempt int       `json:"attempt"`
+	Detail  string    `json:"detail,omitempty"`
+	At      time.Time `json:"at"`
+	// Time spent in this state, until the next event (or now, if current).
+	DurationMs int64 `json:"duration_ms"`
+}
+
+type JobTimeline struct {
+	Job      JobRecord   `json:"job"`
+	Events   []JobEvent  `json:"events"`
+	Children []JobRecord `json:"children,omitempty"` // files of a mirror job
+}
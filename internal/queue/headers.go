@@ -0,0 +1,195 @@
+// Package queue holds the Kafka topic names and message headers shared by
+// the consumer and the kafkasync operator command.
+package queue
+
+import (
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// MainTopic carries DownloadNotification jobs.
+const MainTopic = "kafkasync-files"
+
+// Headers attached to retried, dead-lettered and re-driven messages.
+const (
+	HeaderJobID           = "x-kafkasync-job-id"
+	HeaderRetryAt         = "x-kafkasync-retry-at"
+	HeaderStage           = "x-kafkasync-stage"
+	HeaderError           = "x-kafkasync-error"
+	HeaderAttempts        = "x-kafkasync-attempts"
+	HeaderSourceTopic     = "x-kafkasync-source-topic"
+	HeaderSourcePartition = "x-kafkasync-source-partition"
+	HeaderSourceOffset    = "x-kafkasync-source-offset"
+	HeaderFailedAt        = "x-kafkasync-failed-at"
+	HeaderDeferredSince   = "x-kafkasync-deferred-since"
+	HeaderLooks           = "x-kafkasync-looks"
+)
+
+// Pipeline stages reported in HeaderStage.
+const (
+	StageParse    = "parse"
+	StageDownload = "download"
+	StageVerify   = "verify"
+	StageMove     = "move"
+	StageUpload   = "upload"
+)
+
+// Header returns the last value of key on msg, or "".
+func Header(msg kafka.Message, key string) string {
+	value := ""
+	for _, h := range msg.Headers {
+		if h.Key == key {
+			value = string(h.Value)
+		}
+	}
+	return value
+}
+
+// SetHeader replaces (or appends) key in headers.
+func SetHeader(headers []kafka.Header, key, value string) []kafka.Header {
+	return append(without(headers, key), kafka.Header{Key: key, Value: []byte(value)})
+}
+
+func without(headers []kafka.Header, key string) []kafka.Header {
+	out := make([]kafka.Header, 0, len(headers)+1)
+	for _, h := range headers {
+		if h.Key != key {
+			out = append(out, h)
+		}
+	}
+	return out
+}
+
+// Attempts returns how many times the job in msg has already been tried.
+func Attempts(msg kafka.Message) int {
+	n, err := strconv.Atoi(Header(msg, HeaderAttempts))
+	if err != nil || n < 0 {
+		return 0
+	}
+	return n
+}
+
+// Failure describes why a job was given up on.
+type Failure struct {
+	JobID   string
+	Stage   string
+	Err     string
+	Attempt int
+}
+
+func failureHeaders(headers []kafka.Header, f Failure) []kafka.Header {
+	if f.JobID != "" {
+		headers = SetHeader(headers, HeaderJobID, f.JobID)
+	}
+	headers = SetHeader(headers, HeaderStage, f.Stage)
+	headers = SetHeader(headers, HeaderError, f.Err)
+	return SetHeader(headers, HeaderAttempts, strconv.Itoa(f.Attempt))
+}
+
+// DeadLetter builds the message published to the dead-letter topic: the
+// original key and payload plus headers describing the failure.
+func DeadLetter(msg kafka.Message, f Failure) kafka.Message {
+	headers := failureHeaders(msg.Headers, f)
+	headers = SetHeader(headers, HeaderSourceTopic, msg.Topic)
+	headers = SetHeader(headers, HeaderSourcePartition, strconv.Itoa(msg.Partition))
+	headers = SetHeader(headers, HeaderSourceOffset, strconv.FormatInt(msg.Offset, 10))
+	headers = SetHeader(headers, HeaderFailedAt, time.Now().UTC().Format(time.RFC3339))
+	return kafka.Message{Key: msg.Key, Value: msg.Value, Headers: headers}
+}
+
+// RetryTopic names the delay topic for a tier, e.g. "kafkasync-files-retry-5m".
+func RetryTopic(prefix, tier string) string {
+	return prefix + tier
+}
+
+// Retry builds the message parked on a delay topic until at. It keeps the
+// original key and payload and records the attempt that just failed.
+func Retry(msg kafka.Message, topic string, f Failure, at time.Time) kafka.Message {
+	// A deferral ends once the file was ready; Defer sets it again.
+	headers := without(failureHeaders(msg.Headers, f), HeaderDeferredSince)
+	headers = SetHeader(headers, HeaderRetryAt, at.UTC().Format(time.RFC3339Nano))
+	return kafka.Message{Topic: topic, Key: msg.Key, Value: msg.Value, Headers: headers}
+}
+
+// Defer is Retry for a job whose file was not ready. f.Attempt should be
+// the attempts used before this one, so waiting does not use one up. The
+// time of the first deferral is kept, so the consumer can give up.
+func Defer(msg kafka.Message, topic string, f Failure, at time.Time) kafka.Message {
+	since, ok := DeferredSince(msg)
+	if !ok {
+		since = time.Now()
+	}
+	delayed := Retry(msg, topic, f, at)
+	delayed.Headers = SetHeader(delayed.Headers, HeaderDeferredSince, since.UTC().Format(time.RFC3339Nano))
+	return delayed
+}
+
+// DeferredSince reports when a job was first deferred, if it has been.
+func DeferredSince(msg kafka.Message) (time.Time, bool) {
+	since, err := time.Parse(time.RFC3339Nano, Header(msg, HeaderDeferredSince))
+	return since, err == nil
+}
+
+// Look is what the stable ready policy saw of a file on earlier attempts.
+type Look struct {
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mtime"`
+	Seen    int       `json:"seen"` // looks in a row with this size and time
+	At      time.Time `json:"at"`   // when the last of them was counted
+}
+
+// Looks returns the looks carried by msg, by file name. It is never nil.
+func Looks(msg kafka.Message) map[string]Look {
+	looks := map[string]Look{}
+	if raw := Header(msg, HeaderLooks); raw != "" {
+		if err := json.Unmarshal([]byte(raw), &looks); err != nil {
+			return map[string]Look{} // counting starts over
+		}
+	}
+	return looks
+}
+
+// SetLooks records looks in headers, or drops the header when there are
+// none.
+func SetLooks(headers []kafka.Header, looks map[string]Look) []kafka.Header {
+	if len(looks) == 0 {
+		return without(headers, HeaderLooks)
+	}
+	raw, _ := json.Marshal(looks)
+	return SetHeader(headers, HeaderLooks, string(raw))
+}
+
+// RetryAt reports when a message on a delay topic becomes due.
+func RetryAt(msg kafka.Message) (time.Time, bool) {
+	at, err := time.Parse(time.RFC3339Nano, Header(msg, HeaderRetryAt))
+	return at, err == nil
+}
+
+// Forward turns a delayed message that is due back into a job for
+// MainTopic. The attempt count, deferral and looks travel with it; the
+// failure headers are dropped.
+func Forward(msg kafka.Message) kafka.Message {
+	var headers []kafka.Header
+	for _, h := range msg.Headers {
+		switch h.Key {
+		case HeaderStage, HeaderError, HeaderRetryAt, HeaderSourceTopic, HeaderSourcePartition, HeaderSourceOffset, HeaderFailedAt:
+		default:
+			headers = append(headers, h)
+		}
+	}
+	return kafka.Message{Key: msg.Key, Value: msg.Value, Headers: headers}
+}
+
+// Redrive turns a dead-lettered message back into a job for MainTopic, as
+// if it were new: it gets every retry tier and the full ready_timeout
+// again. Only the job ID is kept.
+func Redrive(msg kafka.Message) kafka.Message {
+	forward := Forward(msg)
+	for _, key := range []string{HeaderAttempts, HeaderDeferredSince, HeaderLooks} {
+		forward.Headers = without(forward.Headers, key)
+	}
+	return forward
+}
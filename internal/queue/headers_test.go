@@ -0,0 +1,89 @@
+package queue
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// A job deferred again keeps the time of its first deferral, so the
+// consumer's ready_timeout counts from then; a normal retry clears it.
+func TestDeferredSince(t *testing.T) {
+	msg := kafka.Message{Key: []byte("a.csv"), Value: []byte("{}")}
+	first := Defer(msg, "retry-30s", Failure{JobID: "j1", Attempt: 0}, time.Now())
+	since, ok := DeferredSince(first)
+	if !ok {
+		t.Fatal("no deferred-since header after Defer")
+	}
+
+	again := Defer(Forward(first), "retry-30s", Failure{JobID: "j1", Attempt: 0}, time.Now().Add(time.Minute))
+	if got, _ := DeferredSince(again); !got.Equal(since) {
+		t.Errorf("deferred again: since = %v, want the first deferral %v", got, since)
+	}
+	if Attempts(again) != 0 {
+		t.Errorf("attempts = %d, want deferrals not to use one up", Attempts(again))
+	}
+
+	if _, ok := DeferredSince(Retry(Forward(again), "retry-5m", Failure{JobID: "j1", Attempt: 1}, time.Now())); ok {
+		t.Error("Retry kept the deferred-since header")
+	}
+}
+
+func TestLooks(t *testing.T) {
+	msg := kafka.Message{Key: []byte("a.csv")}
+	if looks := Looks(msg); looks == nil || len(looks) != 0 {
+		t.Errorf("no header: Looks = %v, want an empty map", looks)
+	}
+
+	mtime := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	want := map[string]Look{"a.csv": {Size: 42, ModTime: mtime, Seen: 2, At: mtime.Add(time.Minute)}}
+	msg.Headers = SetLooks(msg.Headers, want)
+	// They survive a deferral and the trip back to the main topic.
+	again := Forward(Defer(msg, "retry-30s", Failure{JobID: "j1"}, time.Now()))
+	if got := Looks(again); !reflect.DeepEqual(got, want) {
+		t.Errorf("Looks = %v, want %v", got, want)
+	}
+
+	msg.Headers = SetLooks(msg.Headers, nil)
+	if Header(msg, HeaderLooks) != "" {
+		t.Error("SetLooks(nil) kept the header")
+	}
+	msg.Headers = SetHeader(msg.Headers, HeaderLooks, "{not json")
+	if looks := Looks(msg); looks == nil || len(looks) != 0 {
+		t.Errorf("corrupt header: Looks = %v, want an empty map", looks)
+	}
+}
+
+// A re-driven dead letter starts over; a forwarded retry does not.
+func TestRedrive(t *testing.T) {
+	msg := kafka.Message{Key: []byte("a.csv"), Value: []byte("{}")}
+	msg.Headers = SetLooks(msg.Headers, map[string]Look{"a.csv": {Size: 1, Seen: 1}})
+	deferred := Defer(msg, "retry-30s", Failure{JobID: "j1", Attempt: 2}, time.Now())
+	dead := DeadLetter(deferred, Failure{JobID: "j1", Stage: StageDownload, Err: "not ready", Attempt: 3})
+
+	forwarded := Forward(deferred)
+	if _, ok := DeferredSince(forwarded); !ok || Attempts(forwarded) != 2 || len(Looks(forwarded)) != 1 {
+		t.Errorf("Forward dropped the job's progress: headers %v", forwarded.Headers)
+	}
+
+	redriven := Redrive(dead)
+	if _, ok := DeferredSince(redriven); ok {
+		t.Error("Redrive kept the deferred-since header")
+	}
+	if Attempts(redriven) != 0 || Header(redriven, HeaderAttempts) != "" {
+		t.Errorf("attempts = %q, want the header dropped", Header(redriven, HeaderAttempts))
+	}
+	if len(Looks(redriven)) != 0 {
+		t.Error("Redrive kept the stable policy's looks")
+	}
+	for _, key := range []string{HeaderStage, HeaderError, HeaderSourceTopic, HeaderSourcePartition, HeaderSourceOffset, HeaderFailedAt, HeaderRetryAt} {
+		if Header(redriven, key) != "" {
+			t.Errorf("Redrive kept %s", key)
+		}
+	}
+	if Header(redriven, HeaderJobID) != "j1" || string(redriven.Value) != "{}" || string(redriven.Key) != "a.csv" {
+		t.Errorf("Redrive lost the job: %+v", redriven)
+	}
+}
@@ -0,0 +1,20 @@
+package queue
+
+import (
+	"github.com/Mwambama/KafkaSync/internal/model"
+	"github.com/segmentio/kafka-go"
+)
+
+// Publish builds the MainTopic message a producer sends for n.
+func Publish(n model.DownloadNotification) (kafka.Message, error) {
+	value, err := n.Encode()
+	if err != nil {
+		return kafka.Message{}, err
+	}
+	return kafka.Message{Key: n.Key(), Value: value}, nil
+}
+
+// Receive parses a MainTopic message as the consumer sees it.
+func Receive(msg kafka.Message) (model.DownloadNotification, error) {
+	return model.DecodeNotification(msg.Value)
+}
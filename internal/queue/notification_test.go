@@ -0,0 +1,100 @@
+package queue
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/Mwambama/KafkaSync/internal/model"
+	"github.com/segmentio/kafka-go"
+)
+
+// The producer and consumer are separate binaries that may be deployed at
+// different versions, so these tests pin the wire format between them.
+
+func TestNotificationRoundTrip(t *testing.T) {
+	cases := []model.DownloadNotification{
+		{JobID: "6f1c2b7e-0d1e-4a59-9f57-2f8d5c0f4e11", Hash: "sha256:9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08", Name: "invoice_2025.pdf", Location: "/remote/outgoing", Force: true},
+		{Hash: "abc123", Name: "sample.txt", Location: "/remote"},
+		{Hash: "md5:00", Name: "report.csv", Location: "/exports", Remote: "eu-sftp"},
+		{Hash: "sha256:00", Source: "ftps://ftp.partner.example.com/outgoing/daily%20report.csv"},
+		{Name: "ünïcødé file.mkv", Location: "/remote/with spaces"},
+		{Location: "/exports/2025", Mirror: true, Include: []string{"*.csv", "q1/*"}, Exclude: []string{"*.tmp"}, Prefix: "exports"},
+	}
+	for _, want := range cases {
+		msg, err := Publish(want)
+		if err != nil {
+			t.Fatalf("Publish(%+v): %v", want, err)
+		}
+		if string(msg.Key) != want.FileName() {
+			t.Errorf("key = %q, want the file name %q", msg.Key, want.FileName())
+		}
+		got, err := Receive(msg)
+		if err != nil {
+			t.Fatalf("Receive(%s): %v", msg.Value, err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("round trip = %+v, want %+v", got, want)
+		}
+	}
+}
+
+func TestNotificationWireFormat(t *testing.T) {
+	msg, err := Publish(model.DownloadNotification{JobID: "j1", Hash: "md5:00", Name: "a.txt", Location: "/in", Force: true, Remote: "eu"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var fields map[string]any
+	if err := json.Unmarshal(msg.Value, &fields); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]any{"job_id": "j1", "info_hash": "md5:00", "name": "a.txt", "location": "/in", "force": true, "remote": "eu"}
+	if !reflect.DeepEqual(fields, want) {
+		t.Errorf("wire fields = %v, want %v", fields, want)
+	}
+
+	// Optional fields stay off the wire so older consumers see the payload
+	// they always have.
+	msg, _ = Publish(model.DownloadNotification{Hash: "x", Name: "a.txt", Location: "/in"})
+	if string(msg.Value) != `{"info_hash":"x","name":"a.txt","location":"/in"}` {
+		t.Errorf("minimal payload = %s", msg.Value)
+	}
+}
+
+func TestReceiveCompatibility(t *testing.T) {
+	cases := []struct {
+		name  string
+		value string
+		want  model.DownloadNotification
+	}{
+		{
+			name:  "producer without job_id or force",
+			value: `{"info_hash":"abc","name":"a.txt","location":"/in"}`,
+			want:  model.DownloadNotification{Hash: "abc", Name: "a.txt", Location: "/in"},
+		},
+		{
+			name:  "producer without remote",
+			value: `{"job_id":"j3","info_hash":"abc","name":"a.txt","location":"/in","force":true}`,
+			want:  model.DownloadNotification{JobID: "j3", Hash: "abc", Name: "a.txt", Location: "/in", Force: true},
+		},
+		{
+			name:  "newer producer with unknown fields",
+			value: `{"job_id":"j2","info_hash":"abc","name":"a.txt","location":"/in","priority":5}`,
+			want:  model.DownloadNotification{JobID: "j2", Hash: "abc", Name: "a.txt", Location: "/in"},
+		},
+	}
+	for _, c := range cases {
+		got, err := Receive(kafka.Message{Value: []byte(c.value)})
+		if err != nil {
+			t.Errorf("%s: %v", c.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%s: got %+v, want %+v", c.name, got, c.want)
+		}
+	}
+
+	if _, err := Receive(kafka.Message{Value: []byte(`not json`)}); err == nil {
+		t.Error("malformed payload: want an error so the consumer dead-letters it")
+	}
+}
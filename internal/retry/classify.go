@@ -0,0 +1,87 @@
+// Package retry decides whether a failed job is worth trying again.
+package retry
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"syscall"
+
+	"github.com/minio/minio-go/v7"
+)
+
+// Class says whether retrying a failure can help.
+type Class int
+
+const (
+	Transient Class = iota // connection refused, timeouts, S3 5xx, ...
+	Permanent              // file not found, auth failure, bad hash, ...
+)
+
+func (c Class) String() string {
+	if c == Permanent {
+		return "permanent"
+	}
+	return "transient"
+}
+
+type classified struct {
+	err   error
+	class Class
+}
+
+func (c *classified) Error() string { return c.err.Error() }
+func (c *classified) Unwrap() error { return c.err }
+
+// MarkPermanent tags err so Classify reports it as Permanent.
+func MarkPermanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &classified{err: err, class: Permanent}
+}
+
+// MarkTransient tags err so Classify reports it as Transient.
+func MarkTransient(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &classified{err: err, class: Transient}
+}
+
+// Classify inspects err and its chain. Errors it cannot place are treated
+// as transient; the number of retry tiers bounds how often they are retried.
+func Classify(err error) Class {
+	var c *classified
+	if errors.As(err, &c) {
+		return c.class
+	}
+
+	switch {
+	case errors.Is(err, context.DeadlineExceeded),
+		errors.Is(err, syscall.ECONNREFUSED),
+		errors.Is(err, syscall.ECONNRESET),
+		errors.Is(err, syscall.EPIPE),
+		errors.Is(err, io.ErrUnexpectedEOF):
+		return Transient
+	case errors.Is(err, os.ErrNotExist), errors.Is(err, os.ErrPermission):
+		return Permanent
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return Transient
+	}
+
+	var s3Err minio.ErrorResponse
+	if errors.As(err, &s3Err) && s3Err.StatusCode != 0 {
+		if s3Err.StatusCode >= 500 || s3Err.StatusCode == 429 || s3Err.Code == "SlowDown" {
+			return Transient
+		}
+		return Permanent
+	}
+
+	return Transient
+}
@@ -0,0 +1,46 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"syscall"
+	"testing"
+
+	"github.com/minio/minio-go/v7"
+)
+
+func TestClassify(t *testing.T) {
+	refused := &net.OpError{Op: "dial", Net: "tcp", Err: os.NewSyscallError("connect", syscall.ECONNREFUSED)}
+	cases := []struct {
+		name string
+		err  error
+		want Class
+	}{
+		{"connection refused", fmt.Errorf("sftp dial: %w", refused), Transient},
+		{"connection reset", fmt.Errorf("read: %w", syscall.ECONNRESET), Transient},
+		{"deadline", fmt.Errorf("fetch: %w", context.DeadlineExceeded), Transient},
+		{"network timeout", &net.DNSError{Err: "i/o timeout", Name: "sftp.example.com", IsTimeout: true}, Transient},
+		{"s3 500", minio.ErrorResponse{StatusCode: 500, Code: "InternalError"}, Transient},
+		{"s3 503 slow down", minio.ErrorResponse{StatusCode: 503, Code: "SlowDown"}, Transient},
+		{"s3 429", minio.ErrorResponse{StatusCode: 429}, Transient},
+		{"unknown", errors.New("something odd"), Transient},
+
+		{"not found", fmt.Errorf("open /in/a.csv: %w", os.ErrNotExist), Permanent},
+		{"permission denied", fmt.Errorf("open: %w", os.ErrPermission), Permanent},
+		{"s3 no such key", minio.ErrorResponse{StatusCode: 404, Code: "NoSuchKey"}, Permanent},
+		{"s3 access denied", fmt.Errorf("upload: %w", minio.ErrorResponse{StatusCode: 403, Code: "AccessDenied"}), Permanent},
+		{"auth failure", MarkPermanent(errors.New("ssh: unable to authenticate")), Permanent},
+
+		// An explicit mark wins over what the chain would say.
+		{"marked transient", MarkTransient(fmt.Errorf("not ready: %w", os.ErrNotExist)), Transient},
+		{"marked permanent", MarkPermanent(fmt.Errorf("gave up: %w", context.DeadlineExceeded)), Permanent},
+	}
+	for _, c := range cases {
+		if got := Classify(c.err); got != c.want {
+			t.Errorf("%s: Classify(%v) = %v, want %v", c.name, c.err, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,106 @@
+// Package safepath turns file names taken from messages into relative paths
+// that are safe to use under the staging and completed directories and as
+// object keys.
+package safepath
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// ErrRejected is returned for a name that cannot be stored safely.
+var ErrRejected = errors.New("rejected file name")
+
+// maxSegment is the longest file name most filesystems accept, in bytes.
+const maxSegment = 255
+
+// windowsInvalid cannot appear in a Windows file name. ':' would also make
+// "C:x" a drive-relative path and "x:y" an alternate data stream.
+const windowsInvalid = `<>:"|?*\`
+
+// Clean returns name in Unicode NFC as a slash-separated relative path, or
+// an ErrRejected error saying why it cannot be used. It rejects rather than
+// repairs: a name that needs fixing is not what the producer meant to send.
+//
+// Names are checked against Windows rules on every platform, so a file
+// accepted on one consumer can be written by any other.
+func Clean(name string) (string, error) {
+	if !utf8.ValidString(name) {
+		return "", reject(name, "not valid UTF-8")
+	}
+	if strings.IndexFunc(name, unicode.IsControl) >= 0 {
+		return "", reject(name, "contains a control character")
+	}
+	name = norm.NFC.String(name)
+	switch {
+	case name == "":
+		return "", reject(name, "empty")
+	case strings.HasPrefix(name, "/"):
+		return "", reject(name, "absolute path")
+	}
+	for _, seg := range strings.Split(name, "/") {
+		if err := checkSegment(seg); err != nil {
+			return "", reject(name, err.Error())
+		}
+	}
+	return name, nil
+}
+
+func checkSegment(seg string) error {
+	switch {
+	case seg == "":
+		return errors.New("empty path segment")
+	case seg == "." || seg == "..":
+		return fmt.Errorf("%q segment", seg)
+	case len(seg) > maxSegment:
+		return fmt.Errorf("segment longer than %d bytes", maxSegment)
+	}
+	if i := strings.IndexAny(seg, windowsInvalid); i >= 0 {
+		return fmt.Errorf("%q is not allowed in file names", seg[i])
+	}
+	if strings.HasSuffix(seg, ".") || strings.HasSuffix(seg, " ") {
+		return fmt.Errorf("%q ends in a dot or space", seg)
+	}
+	if reserved(seg) {
+		return fmt.Errorf("%q is a reserved device name on Windows", seg)
+	}
+	return nil
+}
+
+// reserved reports whether Windows treats seg as a device, which it does
+// whatever the extension: "nul.txt" is NUL.
+func reserved(seg string) bool {
+	base, _, _ := strings.Cut(seg, ".")
+	base = strings.ToUpper(strings.TrimRight(base, " "))
+	switch base {
+	case "CON", "PRN", "AUX", "NUL", "CONIN$", "CONOUT$":
+		return true
+	}
+	if len(base) > 3 && (base[:3] == "COM" || base[:3] == "LPT") {
+		switch base[3:] {
+		case "0", "1", "2", "3", "4", "5", "6", "7", "8", "9", "¹", "²", "³":
+			return true
+		}
+	}
+	return false
+}
+
+func reject(name, why string) error {
+	return fmt.Errorf("%w %q: %s", ErrRejected, name, why)
+}
+
+// Join is filepath.Join for a name returned by Clean, and checks that the
+// result stays inside dir.
+func Join(dir, name string) (string, error) {
+	rel := filepath.FromSlash(name)
+	if !filepath.IsLocal(rel) {
+		return "", reject(name, "escapes "+dir)
+	}
+	return filepath.Join(dir, rel), nil
+}
@@ -0,0 +1,72 @@
+package safepath
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestClean(t *testing.T) {
+	accepted := map[string]string{
+		"report.pdf":           "report.pdf",
+		"sub/dir/report.pdf":   "sub/dir/report.pdf",
+		"with spaces.txt":      "with spaces.txt",
+		"semi;colon$(x)`y`.gz": "semi;colon$(x)`y`.gz",
+		".hidden":              ".hidden",
+		"a..b":                 "a..b",
+		"console.log":          "console.log",
+		"COM10":                "COM10",
+		"cafe\u0301.txt":       "café.txt", // NFD becomes NFC
+	}
+	for in, want := range accepted {
+		got, err := Clean(in)
+		if err != nil || got != want {
+			t.Errorf("Clean(%q) = %q, %v; want %q", in, got, err, want)
+		}
+	}
+
+	rejected := []string{
+		"",
+		"/etc/passwd",
+		"../../etc/cron.d/x",
+		"a/../../b",
+		"a/./b",
+		"a//b",
+		"dir/",
+		`..\..\windows\system32`,
+		"C:evil.txt",
+		"C:/evil.txt",
+		"file.txt:stream",
+		"what?.txt",
+		"trailing.",
+		"trailing ",
+		"CON",
+		"nul.txt",
+		"sub/Aux.tar.gz",
+		"LPT1",
+		"com\u00b9.txt",
+		"CONOUT$",
+		"new\nline",
+		"esc\x1b[0m",
+		"bad\xffutf8",
+		strings.Repeat("a", 256),
+	}
+	for _, in := range rejected {
+		if got, err := Clean(in); !errors.Is(err, ErrRejected) {
+			t.Errorf("Clean(%q) = %q, %v; want ErrRejected", in, got, err)
+		}
+	}
+}
+
+func TestJoin(t *testing.T) {
+	dir := filepath.Join("staging", "eu")
+	if got, err := Join(dir, "sub/a.txt"); err != nil || got != filepath.Join(dir, "sub", "a.txt") {
+		t.Errorf("Join(sub/a.txt) = %q, %v", got, err)
+	}
+	for _, name := range []string{"../a.txt", "/abs", ""} {
+		if got, err := Join(dir, name); !errors.Is(err, ErrRejected) {
+			t.Errorf("Join(%q) = %q, %v; want ErrRejected", name, got, err)
+		}
+	}
+}
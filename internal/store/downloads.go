@@ -0,0 +1,99 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log/slog"
+
+	"github.com/Mwambama/KafkaSync/internal/model"
+)
+
+// RecordDownload appends one attempt to downloads.
+func (s *Store) RecordDownload(ctx context.Context, d model.Download) error {
+	var throughput sql.NullFloat64
+	if secs := d.DownloadTime.Seconds(); secs > 0 && d.Size > 0 {
+		throughput = sql.NullFloat64{Float64: float64(d.Size) / secs, Valid: true}
+	}
+	var errText sql.NullString
+	if d.Err != nil {
+		errText = sql.NullString{String: d.Err.Error(), Valid: true}
+	}
+	var messageTime sql.NullTime
+	if !d.MessageTime.IsZero() {
+		messageTime = sql.NullTime{Time: d.MessageTime, Valid: true}
+	}
+
+	n := d.Notification
+	_, err := s.db.ExecContext(ctx, `INSERT INTO downloads (
+		filename, remote_location, hash, status, attempt, job_id, remote,
+		size_bytes, download_ms, upload_ms, throughput_bps, error,
+		kafka_topic, kafka_partition, kafka_offset, message_time, consumer_id
+	) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17)`,
+		n.FileName(), n.Origin(), n.Hash, d.Status, d.Attempt, d.JobID, d.Remote,
+		nullInt(d.Size), nullInt(d.DownloadTime.Milliseconds()), nullInt(d.UploadTime.Milliseconds()), throughput, errText,
+		d.KafkaTopic, d.KafkaPartition, d.KafkaOffset, messageTime, d.ConsumerID,
+	)
+	return err
+}
+
+func nullInt(n int64) sql.NullInt64 {
+	return sql.NullInt64{Int64: n, Valid: n > 0}
+}
+
+// Downloads lists every attempt, newest first.
+func (s *Store) Downloads(ctx context.Context) ([]model.DownloadRecord, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT id, job_id, COALESCE(remote, 'default'), filename, remote_location, hash, status, attempt, error,
+		size_bytes, download_ms, upload_ms, throughput_bps,
+		kafka_topic, kafka_partition, kafka_offset, message_time, consumer_id, downloaded_at
+		FROM downloads ORDER BY id DESC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var downloads []model.DownloadRecord
+	for rows.Next() {
+		var d model.DownloadRecord
+		// Scan timestamps as strings for simplicity
+		if err := rows.Scan(&d.ID, &d.JobID, &d.Remote, &d.Filename, &d.RemoteLocation, &d.Hash, &d.Status, &d.Attempt, &d.Error,
+			&d.SizeBytes, &d.DownloadMs, &d.UploadMs, &d.ThroughputBps,
+			&d.KafkaTopic, &d.KafkaPartition, &d.KafkaOffset, &d.MessageTime, &d.ConsumerID, &d.DownloadedAt); err != nil {
+			slog.Error("Error scanning row", "table", "downloads", "error", err)
+			continue
+		}
+		downloads = append(downloads, d)
+	}
+	return downloads, rows.Err()
+}
+
+// Completed returns the size of the file a job last completed and
+// uploaded, if it has. Mirror jobs use it to skip files a previous attempt
+// already fetched.
+func (s *Store) Completed(ctx context.Context, jobID string) (int64, bool, error) {
+	var size sql.NullInt64
+	err := s.db.QueryRowContext(ctx, `SELECT size_bytes FROM downloads
+		WHERE job_id = $1 AND status = 'COMPLETED_AND_UPLOADED'
+		ORDER BY id DESC LIMIT 1`, jobID).Scan(&size)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, err
+	}
+	// Empty files are stored with a NULL size.
+	return size.Int64, true, nil
+}
+
+// Archived reports whether this exact file (same remote, remote location,
+// name and hash) has been completed and uploaded before. Rows written before
+// named remotes existed count as the "default" remote.
+func (s *Store) Archived(ctx context.Context, remote, location, name, hash string) (bool, error) {
+	var found bool
+	err := s.db.QueryRowContext(ctx, `SELECT EXISTS (
+		SELECT 1 FROM downloads
+		WHERE remote_location = $1 AND filename = $2 AND hash = $3 AND status = 'COMPLETED_AND_UPLOADED'
+			AND COALESCE(remote, 'default') = $4
+	)`, location, name, hash, remote).Scan(&found)
+	return found, err
+}
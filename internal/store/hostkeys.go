@@ -0,0 +1,58 @@
+package store
+
+import (
+	"context"
+	"time"
+)
+
+// HostKey is a fingerprint recorded under the trust-on-first-use policy.
+type HostKey struct {
+	Host        string
+	KeyType     string
+	Fingerprint string
+	FirstSeen   time.Time
+}
+
+// TrustHostKey records fingerprint for host unless one is already on record,
+// and returns the fingerprint that is. Concurrent first connections agree on
+// whichever was stored first.
+func (s *Store) TrustHostKey(ctx context.Context, host, keyType, fingerprint string) (string, error) {
+	_, err := s.db.ExecContext(ctx, `INSERT INTO host_keys (host, key_type, fingerprint) VALUES ($1, $2, $3)
+		ON CONFLICT (host) DO NOTHING`, host, keyType, fingerprint)
+	if err != nil {
+		return "", err
+	}
+	var stored string
+	err = s.db.QueryRowContext(ctx, `SELECT fingerprint FROM host_keys WHERE host = $1`, host).Scan(&stored)
+	return stored, err
+}
+
+// HostKeys lists every recorded host key.
+func (s *Store) HostKeys(ctx context.Context) ([]HostKey, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT host, key_type, fingerprint, first_seen FROM host_keys ORDER BY host`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var keys []HostKey
+	for rows.Next() {
+		var k HostKey
+		if err := rows.Scan(&k.Host, &k.KeyType, &k.Fingerprint, &k.FirstSeen); err != nil {
+			return nil, err
+		}
+		keys = append(keys, k)
+	}
+	return keys, rows.Err()
+}
+
+// ForgetHostKey drops the recorded key for host, so the next connection
+// trusts whatever key it presents. It reports whether a key was removed.
+func (s *Store) ForgetHostKey(ctx context.Context, host string) (bool, error) {
+	res, err := s.db.ExecContext(ctx, `DELETE FROM host_keys WHERE host = $1`, host)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
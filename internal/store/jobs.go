@@ -0,0 +1,144 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log/slog"
+	"strconv"
+	"time"
+
+	"github.com/Mwambama/KafkaSync/internal/model"
+)
+
+// StartJob (re)registers a job in RECEIVED, clearing the previous attempt's
+// status. remote is the resolved remote name; parent is the mirror job a
+// file belongs to, empty for top-level jobs.
+func (s *Store) StartJob(ctx context.Context, id, parent, remote string, n model.DownloadNotification, attempt int) error {
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO jobs (job_id, filename, remote_location, hash, state, attempt, remote, parent_id)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, NULLIF($8, ''))
+		ON CONFLICT (job_id) DO UPDATE SET
+			state = EXCLUDED.state, status = NULL, attempt = EXCLUDED.attempt, remote = EXCLUDED.remote,
+			updated_at = CURRENT_TIMESTAMP`,
+		id, n.FileName(), n.Origin(), n.Hash, model.StateReceived, attempt, remote, parent)
+	return err
+}
+
+// SetJobState moves a job to state; status may be empty.
+func (s *Store) SetJobState(ctx context.Context, id, state, status string) error {
+	_, err := s.db.ExecContext(ctx, `UPDATE jobs SET state = $2, status = NULLIF($3, ''), updated_at = CURRENT_TIMESTAMP WHERE job_id = $1`,
+		id, state, status)
+	return err
+}
+
+// AddJobEvent appends to a job's history; detail may be empty.
+func (s *Store) AddJobEvent(ctx context.Context, id, state string, attempt int, detail string) error {
+	_, err := s.db.ExecContext(ctx, `INSERT INTO job_events (job_id, state, attempt, detail) VALUES ($1, $2, $3, NULLIF($4, ''))`,
+		id, state, attempt, detail)
+	return err
+}
+
+const jobColumns = `job_id, COALESCE(remote, 'default'), filename, COALESCE(remote_location, ''), COALESCE(hash, ''), state,
+	COALESCE(status, ''), attempt, COALESCE(parent_id, ''), created_at, updated_at`
+
+func scanJob(row interface{ Scan(...any) error }, j *model.JobRecord) error {
+	return row.Scan(&j.JobID, &j.Remote, &j.Filename, &j.RemoteLocation, &j.Hash, &j.State,
+		&j.Status, &j.Attempt, &j.ParentID, &j.CreatedAt, &j.UpdatedAt)
+}
+
+// Jobs lists the most recently updated jobs, optionally only those in state.
+func (s *Store) Jobs(ctx context.Context, state string, limit int) ([]model.JobRecord, error) {
+	query := "SELECT " + jobColumns + " FROM jobs"
+	args := []any{}
+	if state != "" {
+		query += " WHERE state = $1"
+		args = append(args, state)
+	}
+	query += " ORDER BY updated_at DESC LIMIT " + strconv.Itoa(limit)
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	jobs := []model.JobRecord{}
+	for rows.Next() {
+		var j model.JobRecord
+		if err := scanJob(rows, &j); err != nil {
+			slog.Error("Error scanning row", "table", "jobs", "error", err)
+			continue
+		}
+		jobs = append(jobs, j)
+	}
+	return jobs, rows.Err()
+}
+
+// Timeline returns a job and every state it has passed through, with the
+// time spent in each. A mirror job also lists its files.
+func (s *Store) Timeline(ctx context.Context, id string) (model.JobTimeline, error) {
+	var timeline model.JobTimeline
+	err := scanJob(s.db.QueryRowContext(ctx, "SELECT "+jobColumns+" FROM jobs WHERE job_id = $1", id), &timeline.Job)
+	if errors.Is(err, sql.ErrNoRows) {
+		return timeline, ErrNotFound
+	}
+	if err != nil {
+		return timeline, err
+	}
+
+	rows, err := s.db.QueryContext(ctx, `SELECT state, attempt, COALESCE(detail, ''), created_at
+		FROM job_events WHERE job_id = $1 ORDER BY id`, id)
+	if err != nil {
+		return timeline, err
+	}
+	defer rows.Close()
+
+	timeline.Events = []model.JobEvent{}
+	for rows.Next() {
+		var e model.JobEvent
+		if err := rows.Scan(&e.State, &e.Attempt, &e.Detail, &e.At); err != nil {
+			slog.Error("Error scanning row", "table", "job_events", "error", err)
+			continue
+		}
+		timeline.Events = append(timeline.Events, e)
+	}
+	if err := rows.Err(); err != nil {
+		return timeline, err
+	}
+
+	if timeline.Children, err = s.children(ctx, id); err != nil {
+		return timeline, err
+	}
+
+	for i := range timeline.Events {
+		end := time.Now()
+		if i+1 < len(timeline.Events) {
+			end = timeline.Events[i+1].At
+		} else if s := timeline.Job.State; s == model.StateDone || s == model.StateFailed || s == model.StateDeferred {
+			end = timeline.Events[i].At
+		}
+		timeline.Events[i].DurationMs = end.Sub(timeline.Events[i].At).Milliseconds()
+	}
+	return timeline, nil
+}
+
+// children lists the file jobs of a mirror job, in path order.
+func (s *Store) children(ctx context.Context, parent string) ([]model.JobRecord, error) {
+	rows, err := s.db.QueryContext(ctx, "SELECT "+jobColumns+" FROM jobs WHERE parent_id = $1 ORDER BY filename", parent)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var children []model.JobRecord
+	for rows.Next() {
+		var j model.JobRecord
+		if err := scanJob(rows, &j); err != nil {
+			slog.Error("Error scanning row", "table", "jobs", "error", err)
+			continue
+		}
+		children = append(children, j)
+	}
+	return children, rows.Err()
+}
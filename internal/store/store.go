@@ -0,0 +1,58 @@
+// Package store is the Postgres access shared by the consumer, the API
+// server and the operator CLI, so every query against the schema in
+// internal/migrate lives in one place.
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/Mwambama/KafkaSync/internal/config"
+	"github.com/Mwambama/KafkaSync/internal/migrate"
+	_ "github.com/lib/pq"
+)
+
+var ErrNotFound = errors.New("not found")
+
+type Store struct {
+	db *sql.DB
+}
+
+// DSN builds the lib/pq connection string for cfg.
+func DSN(cfg config.Database) string {
+	return fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=disable",
+		cfg.Host, cfg.Port, cfg.User, cfg.Password, cfg.DbName)
+}
+
+// Open connects to the database without looking at the schema, for tooling
+// that manages the schema itself.
+func Open(cfg config.Database) (*sql.DB, error) {
+	db, err := sql.Open("postgres", DSN(cfg))
+	if err != nil {
+		return nil, err
+	}
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("database unreachable: %w", err)
+	}
+	return db, nil
+}
+
+// Connect opens the database and refuses to continue if the schema is
+// behind the migrations compiled into this binary.
+func Connect(cfg config.Database) (*Store, error) {
+	db, err := Open(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if err := migrate.Check(db); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &Store{db: db}, nil
+}
+
+func (s *Store) Close() error {
+	return s.db.Close()
+}
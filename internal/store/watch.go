@@ -0,0 +1,63 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// WatchedFile is what the watcher last published for one file.
+type WatchedFile struct {
+	Path    string
+	Size    int64     // -1 when the remote does not report sizes
+	ModTime time.Time // zero when the remote does not report times
+	Hash    string
+	JobID   string
+}
+
+// WatchedFiles returns the files recorded for a watch, by path.
+func (s *Store) WatchedFiles(ctx context.Context, watch string) (map[string]WatchedFile, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT path, COALESCE(size_bytes, -1), mtime, COALESCE(hash, ''), COALESCE(job_id, '')
+		FROM watched_files WHERE watch = $1`, watch)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	files := map[string]WatchedFile{}
+	for rows.Next() {
+		var f WatchedFile
+		var mtime sql.NullTime
+		if err := rows.Scan(&f.Path, &f.Size, &mtime, &f.Hash, &f.JobID); err != nil {
+			return nil, err
+		}
+		f.ModTime = mtime.Time
+		files[f.Path] = f
+	}
+	return files, rows.Err()
+}
+
+// MarkWatched records that f has been published.
+func (s *Store) MarkWatched(ctx context.Context, watch string, f WatchedFile) error {
+	mtime := sql.NullTime{Time: f.ModTime, Valid: !f.ModTime.IsZero()}
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO watched_files (watch, path, size_bytes, mtime, hash, job_id)
+		VALUES ($1, $2, $3, $4, NULLIF($5, ''), $6)
+		ON CONFLICT (watch, path) DO UPDATE SET
+			size_bytes = EXCLUDED.size_bytes, mtime = EXCLUDED.mtime, hash = EXCLUDED.hash,
+			job_id = EXCLUDED.job_id, published_at = CURRENT_TIMESTAMP`,
+		watch, f.Path, f.Size, mtime, f.Hash, f.JobID)
+	return err
+}
+
+// ForgetWatched drops files that have gone from the remote, so they are
+// published again if they come back.
+func (s *Store) ForgetWatched(ctx context.Context, watch string, paths []string) error {
+	if len(paths) == 0 {
+		return nil
+	}
+	_, err := s.db.ExecContext(ctx, `DELETE FROM watched_files WHERE watch = $1 AND path = ANY($2)`, watch, pq.Array(paths))
+	return err
+}
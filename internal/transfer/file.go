@@ -0,0 +1,176 @@
+package transfer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+
+	"github.com/Mwambama/KafkaSync/internal/checksum"
+	"github.com/Mwambama/KafkaSync/internal/retry"
+)
+
+func init() {
+	Register("file", newFile, "file")
+}
+
+// File copies from the consumer's own filesystem, for shares mounted on
+// the host. Only files under Root can be read, so a message cannot ask for
+// anything else on the machine.
+type File struct {
+	remote Remote
+	root   string // absolute, symlinks resolved
+}
+
+func newFile(r Remote) (Transferer, error) {
+	if r.Root == "" {
+		return nil, errors.New("the file backend needs a root directory")
+	}
+	root, err := filepath.Abs(expandHome(r.Root))
+	if err == nil {
+		root, err = filepath.EvalSymlinks(root)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("file root: %w", err)
+	}
+	return &File{remote: r, root: root}, nil
+}
+
+func (f *File) Fetch(ctx context.Context, job Job) (string, int64, error) {
+	if err := job.Check(); err != nil {
+		return "", 0, err
+	}
+	src, err := f.path(job)
+	if err != nil {
+		return "", 0, err
+	}
+	localPath := filepath.Join(f.remote.Dir, job.local())
+
+	size, err := resume(ctx, localPath, func(ctx context.Context, offset int64) (io.ReadCloser, int64, bool, error) {
+		in, err := os.Open(src)
+		if err != nil {
+			return nil, 0, false, err
+		}
+		info, err := in.Stat()
+		if err != nil {
+			in.Close()
+			return nil, 0, false, err
+		}
+		if offset > info.Size() {
+			// Not a prefix of this file: start over.
+			return ctxReader{ctx, in}, info.Size(), false, nil
+		}
+		if _, err := in.Seek(offset, io.SeekStart); err != nil {
+			in.Close()
+			return nil, 0, false, err
+		}
+		return ctxReader{ctx, in}, info.Size(), true, nil
+	})
+	if err != nil {
+		return "", 0, err
+	}
+	return localPath, size, nil
+}
+
+// List walks the job's directory. Symlinks are skipped rather than
+// followed, so the walk stays under root.
+func (f *File) List(ctx context.Context, job Job) ([]Entry, error) {
+	if err := job.Check(); err != nil {
+		return nil, err
+	}
+	dir, err := f.path(job)
+	if err != nil {
+		return nil, err
+	}
+	var entries []Entry
+	err = filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		entries = append(entries, Entry{Path: filepath.ToSlash(rel), Size: info.Size(), ModTime: info.ModTime()})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+func (f *File) Stat(ctx context.Context, job Job) (Entry, error) {
+	if err := job.Check(); err != nil {
+		return Entry{}, err
+	}
+	src, err := f.path(job)
+	if err != nil {
+		return Entry{}, err
+	}
+	info, err := os.Stat(src)
+	if err != nil {
+		return Entry{}, err
+	}
+	return Entry{Path: src, Size: info.Size(), ModTime: info.ModTime()}, nil
+}
+
+// Hash computes the first supported algorithm over the file in place.
+func (f *File) Hash(ctx context.Context, job Job, algos ...string) (string, error) {
+	if err := job.Check(); err != nil {
+		return "", err
+	}
+	src, err := f.path(job)
+	if err != nil {
+		return "", err
+	}
+	for _, algo := range algos {
+		if checksum.Supported(algo) {
+			sum, err := checksum.File(src, algo)
+			if err != nil {
+				return "", err
+			}
+			return algo + ":" + sum, nil
+		}
+	}
+	return "", ErrNoHash
+}
+
+// path resolves the job to a file under root. Relative locations are taken
+// from root, and symlinks are followed before the check so a link cannot
+// lead out of it.
+func (f *File) path(job Job) (string, error) {
+	p, err := f.remote.remotePath(job)
+	if err != nil {
+		return "", err
+	}
+	if runtime.GOOS == "windows" && len(p) > 2 && p[0] == '/' && p[2] == ':' {
+		p = p[1:] // file:///C:/data/x
+	}
+	p = filepath.FromSlash(p)
+	if !filepath.IsAbs(p) {
+		p = filepath.Join(f.root, p)
+	}
+	resolved, err := filepath.EvalSymlinks(p)
+	if err != nil {
+		return "", err
+	}
+	if rel, err := filepath.Rel(f.root, resolved); err != nil || !filepath.IsLocal(rel) {
+		return "", retry.MarkPermanent(fmt.Errorf("%w: %s is outside %s", ErrSource, p, f.root))
+	}
+	return resolved, nil
+}
@@ -0,0 +1,425 @@
+package transfer
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/textproto"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Mwambama/KafkaSync/internal/retry"
+)
+
+func init() {
+	Register("ftp", newFTP, "ftp")
+	Register("ftps", newFTP, "ftps")
+}
+
+// FTP fetches over FTP in passive mode, resuming with REST. The ftps backend
+// upgrades the control connection with AUTH TLS and protects the data
+// connection too (explicit FTPS); implicit FTPS on port 990 is not
+// supported.
+type FTP struct {
+	remote Remote
+	scheme string
+	tls    *tls.Config // nil for plain FTP
+}
+
+func newFTP(r Remote) (Transferer, error) {
+	f := &FTP{remote: r, scheme: Schemes(r.Backend)[0]}
+	if f.scheme == "ftps" {
+		host, _, _ := net.SplitHostPort(withPort(r.Host, f.scheme))
+		// Most servers insist the data connection resumes the control
+		// connection's TLS session, hence the cache.
+		f.tls = &tls.Config{ServerName: host, ClientSessionCache: tls.NewLRUClientSessionCache(4)}
+	}
+	return f, nil
+}
+
+func (f *FTP) Fetch(ctx context.Context, job Job) (string, int64, error) {
+	if err := job.Check(); err != nil {
+		return "", 0, err
+	}
+	remotePath, err := f.remote.remotePath(job)
+	if err != nil {
+		return "", 0, err
+	}
+	localPath := filepath.Join(f.remote.Dir, job.local())
+
+	c, err := f.dial(ctx)
+	if err != nil {
+		return "", 0, ftpError(fmt.Errorf("%s connect %s: %w", f.scheme, f.remote.Host, err))
+	}
+	defer c.close()
+	// The protocol has no cancellation: drop the connections instead.
+	stop := context.AfterFunc(ctx, c.close)
+	defer stop()
+
+	size, err := resume(ctx, localPath, func(ctx context.Context, offset int64) (io.ReadCloser, int64, bool, error) {
+		return c.retr(ctx, remotePath, offset)
+	})
+	if err != nil {
+		return "", 0, ftpError(err)
+	}
+	c.cmd(2, "QUIT")
+	return localPath, size, nil
+}
+
+// List walks the job's directory with MLSD. Servers without MLSD cannot be
+// mirrored: LIST output has no standard format.
+func (f *FTP) List(ctx context.Context, job Job) ([]Entry, error) {
+	if err := job.Check(); err != nil {
+		return nil, err
+	}
+	dir, err := f.remote.remotePath(job)
+	if err != nil {
+		return nil, err
+	}
+	c, err := f.dial(ctx)
+	if err != nil {
+		return nil, ftpError(fmt.Errorf("%s connect %s: %w", f.scheme, f.remote.Host, err))
+	}
+	defer c.close()
+	stop := context.AfterFunc(ctx, c.close)
+	defer stop()
+
+	var entries []Entry
+	var walk func(rel string) error
+	walk = func(rel string) error {
+		names, err := c.mlsd(ctx, path.Join(dir, rel))
+		if err != nil {
+			return err
+		}
+		for _, e := range names {
+			switch p := path.Join(rel, e.name); e.kind {
+			case "file":
+				entries = append(entries, Entry{Path: p, Size: e.size, ModTime: e.modTime})
+			case "dir":
+				if err := walk(p); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+	if err := walk(""); err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, ftpError(err)
+	}
+	c.cmd(2, "QUIT")
+	return entries, nil
+}
+
+// Stat asks for SIZE and MDTM. A server without MDTM gives a zero ModTime.
+func (f *FTP) Stat(ctx context.Context, job Job) (Entry, error) {
+	if err := job.Check(); err != nil {
+		return Entry{}, err
+	}
+	remotePath, err := f.remote.remotePath(job)
+	if err != nil {
+		return Entry{}, err
+	}
+	c, err := f.dial(ctx)
+	if err != nil {
+		return Entry{}, ftpError(fmt.Errorf("%s connect %s: %w", f.scheme, f.remote.Host, err))
+	}
+	defer c.close()
+	stop := context.AfterFunc(ctx, c.close)
+	defer stop()
+
+	e := Entry{Path: remotePath, Size: -1}
+	_, msg, err := c.cmd(213, "SIZE %s", remotePath)
+	if err != nil {
+		return Entry{}, ftpError(err)
+	}
+	if e.Size, err = strconv.ParseInt(strings.TrimSpace(msg), 10, 64); err != nil {
+		return Entry{}, fmt.Errorf("ftp: bad SIZE reply %q", msg)
+	}
+	if _, msg, err := c.cmd(213, "MDTM %s", remotePath); err == nil && len(strings.TrimSpace(msg)) >= 14 {
+		e.ModTime, _ = time.Parse("20060102150405", strings.TrimSpace(msg)[:14])
+	}
+	c.cmd(2, "QUIT")
+	return e, nil
+}
+
+// ftpConn is one logged-in control connection.
+type ftpConn struct {
+	f    *FTP
+	text *textproto.Conn
+	host string // address the data connections go to
+
+	mu    sync.Mutex
+	conns []net.Conn // control and any open data connection, for close
+}
+
+func (f *FTP) dial(ctx context.Context) (*ftpConn, error) {
+	addr := withPort(f.remote.Host, f.scheme)
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	c := &ftpConn{f: f, text: textproto.NewConn(conn), conns: []net.Conn{conn}}
+	c.host, _, _ = net.SplitHostPort(conn.RemoteAddr().String())
+	stop := context.AfterFunc(ctx, c.close)
+	defer stop()
+
+	if err := c.login(ctx, conn); err != nil {
+		c.close()
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, err
+	}
+	return c, nil
+}
+
+func (c *ftpConn) login(ctx context.Context, conn net.Conn) error {
+	if _, _, err := c.text.ReadResponse(2); err != nil {
+		return err
+	}
+	if c.f.tls != nil {
+		if _, _, err := c.cmd(234, "AUTH TLS"); err != nil {
+			return err
+		}
+		tlsConn := tls.Client(conn, c.f.tls)
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			return err
+		}
+		c.track(tlsConn)
+		c.text = textproto.NewConn(tlsConn)
+	}
+
+	user := c.f.remote.Username
+	if user == "" {
+		user = "anonymous"
+	}
+	reply, msg, err := c.cmd(0, "USER %s", user)
+	switch {
+	case err != nil:
+		return err
+	case reply == 331 || reply == 332:
+		if _, _, err := c.cmd(230, "PASS %s", c.f.remote.Password); err != nil {
+			return err
+		}
+	case reply != 230:
+		return &textproto.Error{Code: reply, Msg: msg}
+	}
+
+	if c.f.tls != nil {
+		if _, _, err := c.cmd(200, "PBSZ 0"); err != nil {
+			return err
+		}
+		if _, _, err := c.cmd(200, "PROT P"); err != nil {
+			return err
+		}
+	}
+	_, _, err = c.cmd(200, "TYPE I")
+	return err
+}
+
+// cmd sends one command and reads its reply. expect is a full code or a
+// single digit for the class; 0 accepts anything.
+func (c *ftpConn) cmd(expect int, format string, args ...any) (int, string, error) {
+	id, err := c.text.Cmd(format, args...)
+	if err != nil {
+		return 0, "", err
+	}
+	c.text.StartResponse(id)
+	defer c.text.EndResponse(id)
+	return c.text.ReadResponse(expect)
+}
+
+// retr starts downloading path from offset. The returned body reads the
+// transfer's final reply on Close, so a transfer the server aborted is not
+// taken for a complete file.
+func (c *ftpConn) retr(ctx context.Context, path string, offset int64) (io.ReadCloser, int64, bool, error) {
+	total := int64(-1)
+	if _, msg, err := c.cmd(213, "SIZE %s", path); err == nil {
+		total, _ = strconv.ParseInt(strings.TrimSpace(msg), 10, 64)
+	} else if code(err) == 550 {
+		return nil, 0, false, err
+	}
+	if total >= 0 && offset > total {
+		offset = 0
+	}
+
+	data, err := c.passive(ctx)
+	if err != nil {
+		return nil, 0, false, err
+	}
+	resumed := false
+	if offset > 0 {
+		if _, _, err := c.cmd(350, "REST %d", offset); err == nil {
+			resumed = true
+		}
+	}
+	if _, _, err := c.cmd(1, "RETR %s", path); err != nil {
+		data.Close()
+		return nil, 0, false, err
+	}
+	if c.f.tls != nil {
+		tlsData := tls.Client(data, c.f.tls)
+		c.track(tlsData)
+		data = tlsData
+	}
+	return &ftpData{Conn: data, c: c}, total, resumed, nil
+}
+
+type mlsdEntry struct {
+	name    string
+	kind    string // "file" or "dir"; others such as "cdir" are not listed
+	size    int64
+	modTime time.Time
+}
+
+// mlsd lists one directory. Names with a slash are dropped: they cannot be
+// real entries of this directory.
+func (c *ftpConn) mlsd(ctx context.Context, dir string) ([]mlsdEntry, error) {
+	data, err := c.passive(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if _, _, err := c.cmd(1, "MLSD %s", dir); err != nil {
+		data.Close()
+		return nil, err
+	}
+	if c.f.tls != nil {
+		tlsData := tls.Client(data, c.f.tls)
+		c.track(tlsData)
+		data = tlsData
+	}
+	body := &ftpData{Conn: data, c: c}
+	raw, err := io.ReadAll(body)
+	if cerr := body.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// "type=file;size=1024;modify=20240101000000; name.csv"
+	var entries []mlsdEntry
+	for _, line := range strings.Split(string(raw), "\n") {
+		facts, name, ok := strings.Cut(strings.TrimRight(line, "\r"), " ")
+		if !ok || name == "" || strings.Contains(name, "/") {
+			continue
+		}
+		e := mlsdEntry{name: name, size: -1}
+		for _, fact := range strings.Split(facts, ";") {
+			k, v, _ := strings.Cut(fact, "=")
+			switch strings.ToLower(k) {
+			case "type":
+				e.kind = strings.ToLower(v)
+			case "size":
+				if n, err := strconv.ParseInt(v, 10, 64); err == nil {
+					e.size = n
+				}
+			case "modify":
+				// UTC, YYYYMMDDHHMMSS with optional fractional seconds.
+				if len(v) >= 14 {
+					e.modTime, _ = time.Parse("20060102150405", v[:14])
+				}
+			}
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+// passive opens a data connection with EPSV, falling back to PASV. Either
+// way it connects to the control connection's address, never to one the
+// server names, so a hostile server cannot point it elsewhere.
+func (c *ftpConn) passive(ctx context.Context) (net.Conn, error) {
+	var port string
+	if _, msg, err := c.cmd(229, "EPSV"); err == nil {
+		// "Entering Extended Passive Mode (|||6446|)"
+		if _, rest, ok := strings.Cut(msg, "(|||"); ok {
+			port, _, _ = strings.Cut(rest, "|")
+		}
+	} else if _, msg, err := c.cmd(227, "PASV"); err == nil {
+		// "Entering Passive Mode (h1,h2,h3,h4,p1,p2)"
+		start, end := strings.IndexByte(msg, '('), strings.IndexByte(msg, ')')
+		if start >= 0 && end > start {
+			if f := strings.Split(msg[start+1:end], ","); len(f) == 6 {
+				p1, err1 := strconv.Atoi(f[4])
+				p2, err2 := strconv.Atoi(f[5])
+				if err1 == nil && err2 == nil {
+					port = strconv.Itoa(p1<<8 | p2)
+				}
+			}
+		}
+	} else {
+		return nil, err
+	}
+	if port == "" {
+		return nil, errors.New("ftp: could not parse passive mode reply")
+	}
+
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", net.JoinHostPort(c.host, port))
+	if err != nil {
+		return nil, err
+	}
+	c.track(conn)
+	return conn, nil
+}
+
+func (c *ftpConn) track(conn net.Conn) {
+	c.mu.Lock()
+	c.conns = append(c.conns, conn)
+	c.mu.Unlock()
+}
+
+func (c *ftpConn) close() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, conn := range c.conns {
+		conn.Close()
+	}
+}
+
+type ftpData struct {
+	net.Conn
+	c *ftpConn
+}
+
+// Close ends the data connection and reads the 226 that says the server
+// sent everything.
+func (d *ftpData) Close() error {
+	d.Conn.Close()
+	_, _, err := d.c.text.ReadResponse(2)
+	return err
+}
+
+func code(err error) int {
+	var protoErr *textproto.Error
+	if errors.As(err, &protoErr) {
+		return protoErr.Code
+	}
+	return 0
+}
+
+// ftpError classifies server replies: 4xx is worth retrying, 5xx is not.
+func ftpError(err error) error {
+	switch c := code(err); {
+	case c == 550:
+		return retry.MarkPermanent(fmt.Errorf("%w: %w", os.ErrNotExist, err))
+	case c >= 500:
+		return retry.MarkPermanent(err)
+	case c >= 400:
+		return retry.MarkTransient(err)
+	}
+	return err
+}
@@ -0,0 +1,173 @@
+package transfer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/Mwambama/KafkaSync/internal/retry"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// Host key policies for Remote.HostKeyPolicy.
+const (
+	// HostKeyStrict only accepts keys from known_hosts or the pinned
+	// fingerprint. It is the default.
+	HostKeyStrict = "strict"
+	// HostKeyTOFU records the first key a host presents and rejects any
+	// other key afterwards.
+	HostKeyTOFU = "trust-on-first-use"
+	// HostKeyInsecure accepts any key, like lftp's `sftp:auto-confirm yes`.
+	HostKeyInsecure = "insecure"
+)
+
+// ErrHostKey is returned when a remote presents a host key that does not
+// match what is on record, or that cannot be verified at all.
+var ErrHostKey = errors.New("host key verification failed")
+
+// HostKeyStore keeps fingerprints for the trust-on-first-use policy.
+type HostKeyStore interface {
+	// TrustHostKey records fingerprint for host if nothing is recorded yet
+	// and returns the fingerprint on record.
+	TrustHostKey(ctx context.Context, host, keyType, fingerprint string) (string, error)
+}
+
+func (r Remote) hostKeyPolicy() string {
+	if r.HostKeyPolicy == "" {
+		return HostKeyStrict
+	}
+	return r.HostKeyPolicy
+}
+
+// knownHostsFile is the known_hosts used by the strict policy.
+func (r Remote) knownHostsFile() string {
+	if r.KnownHosts != "" {
+		return expandHome(r.KnownHosts)
+	}
+	home, _ := os.UserHomeDir()
+	return filepath.Join(home, ".ssh", "known_hosts")
+}
+
+func hostKeyError(format string, args ...any) error {
+	return retry.MarkPermanent(fmt.Errorf("%w: "+format, append([]any{ErrHostKey}, args...)...))
+}
+
+// hostKeyCallback verifies the server's key according to the remote's policy.
+func hostKeyCallback(ctx context.Context, r Remote) (ssh.HostKeyCallback, error) {
+	policy := r.hostKeyPolicy()
+	if policy == HostKeyInsecure {
+		return ssh.InsecureIgnoreHostKey(), nil
+	}
+
+	if r.HostKey != "" {
+		want := r.HostKey
+		if !strings.HasPrefix(want, "SHA256:") {
+			want = "SHA256:" + want
+		}
+		return func(host string, _ net.Addr, key ssh.PublicKey) error {
+			if got := ssh.FingerprintSHA256(key); got != want {
+				return hostKeyError("%s presented %s %s, pinned %s", host, key.Type(), got, want)
+			}
+			return nil
+		}, nil
+	}
+
+	switch policy {
+	case HostKeyStrict:
+		file := r.knownHostsFile()
+		check, err := knownhosts.New(file)
+		if err != nil {
+			return nil, retry.MarkPermanent(fmt.Errorf("known_hosts: %w", err))
+		}
+		return func(host string, remote net.Addr, key ssh.PublicKey) error {
+			err := check(host, remote, key)
+			var keyErr *knownhosts.KeyError
+			switch {
+			case errors.As(err, &keyErr) && len(keyErr.Want) > 0:
+				return hostKeyError("%s presented %s %s, which does not match %s:%d",
+					host, key.Type(), ssh.FingerprintSHA256(key), keyErr.Want[0].Filename, keyErr.Want[0].Line)
+			case errors.As(err, &keyErr):
+				return hostKeyError("%s is not in %s (presented %s %s)", host, file, key.Type(), ssh.FingerprintSHA256(key))
+			case err != nil:
+				return hostKeyError("%v", err)
+			}
+			return nil
+		}, nil
+
+	case HostKeyTOFU:
+		if r.HostKeys == nil {
+			return nil, fmt.Errorf("host key policy %s needs a host key store", HostKeyTOFU)
+		}
+		return func(host string, _ net.Addr, key ssh.PublicKey) error {
+			got := ssh.FingerprintSHA256(key)
+			stored, err := r.HostKeys.TrustHostKey(ctx, r.Host, key.Type(), got)
+			if err != nil {
+				return fmt.Errorf("recording host key: %w", err)
+			}
+			if stored != got {
+				return hostKeyError("%s presented %s %s, first seen with %s", host, key.Type(), got, stored)
+			}
+			return nil
+		}, nil
+	}
+	return nil, fmt.Errorf("unknown host key policy %q", policy)
+}
+
+// authMethods offers, in order, the private key, the agent and the password,
+// whichever are configured.
+func authMethods(r Remote) ([]ssh.AuthMethod, func(), error) {
+	var methods []ssh.AuthMethod
+	cleanup := func() {}
+
+	if r.PrivateKey != "" {
+		pem, err := os.ReadFile(expandHome(r.PrivateKey))
+		if err != nil {
+			return nil, cleanup, retry.MarkPermanent(fmt.Errorf("private key: %w", err))
+		}
+		var signer ssh.Signer
+		if r.Passphrase != "" {
+			signer, err = ssh.ParsePrivateKeyWithPassphrase(pem, []byte(r.Passphrase))
+		} else {
+			signer, err = ssh.ParsePrivateKey(pem)
+		}
+		if err != nil {
+			return nil, cleanup, retry.MarkPermanent(fmt.Errorf("private key %s: %w", r.PrivateKey, err))
+		}
+		methods = append(methods, ssh.PublicKeys(signer))
+	}
+
+	if sock := r.agentSocket(); sock != "" {
+		conn, err := net.Dial("unix", sock)
+		if err != nil {
+			return nil, cleanup, fmt.Errorf("ssh agent %s: %w", sock, err)
+		}
+		cleanup = func() { conn.Close() }
+		methods = append(methods, ssh.PublicKeysCallback(agent.NewClient(conn).Signers))
+	}
+
+	if r.Password != "" {
+		methods = append(methods, ssh.Password(r.Password))
+	}
+	return methods, cleanup, nil
+}
+
+// agentSocket expands environment references such as $SSH_AUTH_SOCK.
+func (r Remote) agentSocket() string {
+	return os.ExpandEnv(r.AgentSocket)
+}
+
+// expandHome resolves a leading "~/" the way a shell would.
+func expandHome(p string) string {
+	if rest, ok := strings.CutPrefix(p, "~/"); ok {
+		if home, err := os.UserHomeDir(); err == nil {
+			return filepath.Join(home, rest)
+		}
+	}
+	return p
+}
@@ -0,0 +1,146 @@
+package transfer
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/Mwambama/KafkaSync/internal/retry"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+func newHostKey(t *testing.T) ssh.PublicKey {
+	t.Helper()
+	pub, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := ssh.NewPublicKey(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+// memHostKeys is a HostKeyStore in memory.
+type memHostKeys struct {
+	mu   sync.Mutex
+	keys map[string]string
+}
+
+func (m *memHostKeys) TrustHostKey(ctx context.Context, host, keyType, fingerprint string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if stored, ok := m.keys[host]; ok {
+		return stored, nil
+	}
+	m.keys[host] = fingerprint
+	return fingerprint, nil
+}
+
+const testHost = "sftp.example.com:22"
+
+var testAddr = &net.TCPAddr{IP: net.IPv4(192, 0, 2, 10), Port: 22}
+
+// checkHostKey builds the remote's callback and runs it against key.
+func checkHostKey(t *testing.T, r Remote, key ssh.PublicKey) error {
+	t.Helper()
+	check, err := hostKeyCallback(context.Background(), r)
+	if err != nil {
+		t.Fatalf("hostKeyCallback(%s): %v", r.hostKeyPolicy(), err)
+	}
+	return check(testHost, testAddr, key)
+}
+
+func wantHostKeyError(t *testing.T, what string, err error) {
+	t.Helper()
+	if !errors.Is(err, ErrHostKey) || retry.Classify(err) != retry.Permanent {
+		t.Errorf("%s: err = %v, want a permanent ErrHostKey", what, err)
+	}
+}
+
+func TestHostKeyStrict(t *testing.T) {
+	known, other := newHostKey(t), newHostKey(t)
+	file := filepath.Join(t.TempDir(), "known_hosts")
+	line := knownhosts.Line([]string{knownhosts.Normalize(testHost)}, known)
+	if err := os.WriteFile(file, []byte(line+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	r := Remote{Host: testHost, KnownHosts: file}
+
+	if err := checkHostKey(t, r, known); err != nil {
+		t.Errorf("key in known_hosts: %v", err)
+	}
+	err := checkHostKey(t, r, other)
+	wantHostKeyError(t, "changed key", err)
+	if err != nil && !strings.Contains(err.Error(), file+":1") {
+		t.Errorf("changed key: err = %v, want it to point at %s:1", err, file)
+	}
+
+	r.Host = "unknown.example.com:22"
+	check, _ := hostKeyCallback(context.Background(), r)
+	wantHostKeyError(t, "unknown host", check(r.Host, testAddr, known))
+
+	r.KnownHosts = filepath.Join(t.TempDir(), "missing")
+	if _, err := hostKeyCallback(context.Background(), r); err == nil || retry.Classify(err) != retry.Permanent {
+		t.Errorf("missing known_hosts: err = %v, want a permanent error", err)
+	}
+}
+
+func TestHostKeyPinned(t *testing.T) {
+	pinned, other := newHostKey(t), newHostKey(t)
+	fingerprint := ssh.FingerprintSHA256(pinned)
+	for _, pin := range []string{fingerprint, strings.TrimPrefix(fingerprint, "SHA256:")} {
+		// A pin wins over every policy but insecure.
+		for _, policy := range []string{"", HostKeyStrict, HostKeyTOFU} {
+			r := Remote{Host: testHost, HostKey: pin, HostKeyPolicy: policy, KnownHosts: "/nonexistent"}
+			if err := checkHostKey(t, r, pinned); err != nil {
+				t.Errorf("pin %q, policy %q: pinned key rejected: %v", pin, policy, err)
+			}
+			wantHostKeyError(t, "pin "+pin+", other key", checkHostKey(t, r, other))
+		}
+	}
+}
+
+func TestHostKeyTOFU(t *testing.T) {
+	first, second := newHostKey(t), newHostKey(t)
+	store := &memHostKeys{keys: map[string]string{}}
+	r := Remote{Host: testHost, HostKeyPolicy: HostKeyTOFU, HostKeys: store}
+
+	if err := checkHostKey(t, r, first); err != nil {
+		t.Fatalf("first connection: %v", err)
+	}
+	if got, want := store.keys[testHost], ssh.FingerprintSHA256(first); got != want {
+		t.Errorf("recorded %q, want %q", got, want)
+	}
+	if err := checkHostKey(t, r, first); err != nil {
+		t.Errorf("same key again: %v", err)
+	}
+	wantHostKeyError(t, "key changed after first use", checkHostKey(t, r, second))
+	if got := store.keys[testHost]; got != ssh.FingerprintSHA256(first) {
+		t.Errorf("a mismatch replaced the recorded key with %q", got)
+	}
+
+	r.HostKeys = nil
+	if _, err := hostKeyCallback(context.Background(), r); err == nil {
+		t.Error("trust-on-first-use without a store: want an error")
+	}
+}
+
+func TestHostKeyInsecure(t *testing.T) {
+	r := Remote{Host: testHost, HostKeyPolicy: HostKeyInsecure, HostKey: "SHA256:not-this-one"}
+	if err := checkHostKey(t, r, newHostKey(t)); err != nil {
+		t.Errorf("insecure: %v", err)
+	}
+	if _, err := hostKeyCallback(context.Background(), Remote{HostKeyPolicy: "sometimes"}); err == nil {
+		t.Error("unknown policy: want an error")
+	}
+}
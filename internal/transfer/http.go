@@ -0,0 +1,160 @@
+package transfer
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/Mwambama/KafkaSync/internal/retry"
+)
+
+func init() {
+	Register("http", newHTTP, "http")
+	Register("https", newHTTP, "https")
+}
+
+// HTTP fetches with GET, resuming a partial file with a Range request.
+// Username and password, when set, are sent as basic auth.
+type HTTP struct {
+	remote Remote
+	client *http.Client
+}
+
+func newHTTP(r Remote) (Transferer, error) {
+	return &HTTP{remote: r, client: &http.Client{Transport: http.DefaultTransport.(*http.Transport).Clone()}}, nil
+}
+
+func (h *HTTP) Fetch(ctx context.Context, job Job) (string, int64, error) {
+	if err := job.Check(); err != nil {
+		return "", 0, err
+	}
+	u, err := h.remote.sourceURL(job)
+	if err != nil {
+		return "", 0, err
+	}
+	localPath := filepath.Join(h.remote.Dir, job.local())
+
+	size, err := resume(ctx, localPath, func(ctx context.Context, offset int64) (io.ReadCloser, int64, bool, error) {
+		return h.get(ctx, u.String(), offset)
+	})
+	if err != nil {
+		return "", 0, err
+	}
+	return localPath, size, nil
+}
+
+// Stat sends a HEAD request. Size is -1 and ModTime zero when the server
+// leaves out Content-Length or Last-Modified.
+func (h *HTTP) Stat(ctx context.Context, job Job) (Entry, error) {
+	if err := job.Check(); err != nil {
+		return Entry{}, err
+	}
+	u, err := h.remote.sourceURL(job)
+	if err != nil {
+		return Entry{}, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, u.String(), nil)
+	if err != nil {
+		return Entry{}, retry.MarkPermanent(err)
+	}
+	if h.remote.Username != "" || h.remote.Password != "" {
+		req.SetBasicAuth(h.remote.Username, h.remote.Password)
+	}
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return Entry{}, err
+	}
+	resp.Body.Close()
+	switch {
+	case resp.StatusCode == http.StatusNotFound, resp.StatusCode == http.StatusGone:
+		return Entry{}, fmt.Errorf("%w: HEAD %s: %s", os.ErrNotExist, u, resp.Status)
+	case resp.StatusCode != http.StatusOK:
+		return Entry{}, fmt.Errorf("HEAD %s: %s", u, resp.Status)
+	}
+	modTime, _ := http.ParseTime(resp.Header.Get("Last-Modified"))
+	return Entry{Path: u.Path, Size: resp.ContentLength, ModTime: modTime}, nil
+}
+
+// get asks for the body from offset on. A server that ignores Range answers
+// 200 and the download starts over.
+func (h *HTTP) get(ctx context.Context, url string, offset int64) (io.ReadCloser, int64, bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, 0, false, retry.MarkPermanent(err)
+	}
+	if h.remote.Username != "" || h.remote.Password != "" {
+		req.SetBasicAuth(h.remote.Username, h.remote.Password)
+	}
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return nil, 0, false, err
+	}
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return resp.Body, resp.ContentLength, false, nil
+	case http.StatusPartialContent:
+		start, total, ok := contentRange(resp.Header.Get("Content-Range"))
+		if !ok || start != offset {
+			resp.Body.Close()
+			return h.get(ctx, url, 0)
+		}
+		return resp.Body, total, true, nil
+	case http.StatusRequestedRangeNotSatisfiable:
+		// Either the partial file is already complete or the remote file
+		// shrank; only the first can be kept.
+		resp.Body.Close()
+		if _, total, ok := contentRange(resp.Header.Get("Content-Range")); ok && total == offset {
+			return http.NoBody, total, true, nil
+		}
+		return h.get(ctx, url, 0)
+	}
+
+	resp.Body.Close()
+	err = fmt.Errorf("GET %s: %s", url, resp.Status)
+	switch {
+	case resp.StatusCode == http.StatusNotFound, resp.StatusCode == http.StatusGone:
+		return nil, 0, false, retry.MarkPermanent(fmt.Errorf("%w: %w", os.ErrNotExist, err))
+	case resp.StatusCode >= 500, resp.StatusCode == http.StatusTooManyRequests, resp.StatusCode == http.StatusRequestTimeout:
+		return nil, 0, false, retry.MarkTransient(err)
+	default:
+		return nil, 0, false, retry.MarkPermanent(err)
+	}
+}
+
+// contentRange parses "bytes start-end/total" and "bytes */total". total is
+// -1 when the server sends "*".
+func contentRange(header string) (start, total int64, ok bool) {
+	spec, found := strings.CutPrefix(header, "bytes ")
+	if !found {
+		return 0, 0, false
+	}
+	rng, size, found := strings.Cut(spec, "/")
+	if !found {
+		return 0, 0, false
+	}
+	total = -1
+	if size != "*" {
+		var err error
+		if total, err = strconv.ParseInt(size, 10, 64); err != nil {
+			return 0, 0, false
+		}
+	}
+	if rng == "*" {
+		return 0, total, true
+	}
+	first, _, found := strings.Cut(rng, "-")
+	if !found {
+		return 0, 0, false
+	}
+	start, err := strconv.ParseInt(first, 10, 64)
+	return start, total, err == nil
+}
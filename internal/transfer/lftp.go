@@ -0,0 +1,290 @@
+package transfer
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+	"unicode"
+
+	"github.com/Mwambama/KafkaSync/internal/logging"
+	"github.com/Mwambama/KafkaSync/internal/retry"
+)
+
+func init() {
+	Register("lftp", func(r Remote) (Transferer, error) {
+		return newLFTP(r, runtime.GOOS == "windows")
+	}, "sftp")
+	Register("lftp-direct", func(r Remote) (Transferer, error) {
+		return newLFTP(r, false)
+	}, "sftp")
+	Register("lftp-wsl", func(r Remote) (Transferer, error) {
+		return newLFTP(r, true)
+	}, "sftp")
+}
+
+// newLFTP rejects settings that ssh, which lftp runs underneath, cannot
+// honour without a prompt or a database.
+func newLFTP(r Remote, wsl bool) (*LFTP, error) {
+	switch {
+	case r.hostKeyPolicy() == HostKeyTOFU:
+		return nil, fmt.Errorf("host key policy %s needs the native backend", HostKeyTOFU)
+	case r.hostKeyPolicy() != HostKeyStrict && r.hostKeyPolicy() != HostKeyInsecure:
+		return nil, fmt.Errorf("unknown host key policy %q", r.HostKeyPolicy)
+	case r.HostKey != "" && r.hostKeyPolicy() != HostKeyInsecure:
+		return nil, fmt.Errorf("pinned host key fingerprints need the native backend; use known_hosts with lftp")
+	case r.Passphrase != "":
+		return nil, fmt.Errorf("encrypted private keys need the native backend; load the key into ssh-agent for lftp")
+	}
+	return &LFTP{remote: r, wsl: wsl}, nil
+}
+
+// LFTP runs `lftp pget` as a subprocess, either directly or through wsl.exe.
+type LFTP struct {
+	remote Remote
+	wsl    bool
+}
+
+func (l *LFTP) Fetch(ctx context.Context, job Job) (string, int64, error) {
+	script, err := l.script(job)
+	if err != nil {
+		return "", 0, err
+	}
+	localPath := filepath.Join(l.remote.Dir, job.local())
+	if err := os.MkdirAll(filepath.Dir(localPath), 0755); err != nil {
+		return "", 0, err
+	}
+	var stdout io.Writer
+	if l.remote.Verbose {
+		stdout = os.Stdout
+	}
+	if err := l.run(ctx, script, stdout); err != nil {
+		return "", 0, err
+	}
+
+	info, err := os.Stat(localPath)
+	if err != nil {
+		return localPath, 0, fmt.Errorf("%w: %s", ErrMissing, localPath)
+	}
+	return localPath, info.Size(), nil
+}
+
+// List runs lftp's find on the job's directory. find prints no sizes, so
+// every entry's Size is -1.
+func (l *LFTP) List(ctx context.Context, job Job) ([]Entry, error) {
+	if err := job.Check(); err != nil {
+		return nil, err
+	}
+	dir, err := l.remote.remotePath(job)
+	if err != nil {
+		return nil, err
+	}
+	var s lftpScript
+	l.open(&s)
+	s.command("find", remoteArg(dir))
+	s.command("bye")
+	if s.err != nil {
+		return nil, retry.MarkPermanent(fmt.Errorf("lftp: %w", s.err))
+	}
+
+	var out bytes.Buffer
+	if err := l.run(ctx, s.String(), &out); err != nil {
+		return nil, err
+	}
+	// find prints the directory itself, then every path under it; those of
+	// directories end in "/".
+	prefix := strings.TrimSuffix(dir, "/") + "/"
+	var entries []Entry
+	for _, line := range strings.Split(out.String(), "\n") {
+		rel, ok := strings.CutPrefix(strings.TrimSuffix(line, "\r"), prefix)
+		if ok && rel != "" && !strings.HasSuffix(rel, "/") {
+			entries = append(entries, Entry{Path: rel, Size: -1})
+		}
+	}
+	return entries, nil
+}
+
+// Stat goes through the native SFTP client with the same credentials: lftp
+// has no listing format that reliably gives both size and time.
+func (l *LFTP) Stat(ctx context.Context, job Job) (Entry, error) {
+	r := l.remote
+	r.Host = withPort(r.Host, "sftp")
+	native, err := NewSFTPClient(r)
+	if err != nil {
+		return Entry{}, err
+	}
+	return native.(Stater).Stat(ctx, job)
+}
+
+// run feeds script to lftp, copying its output to stdout if that is set.
+func (l *LFTP) run(ctx context.Context, script string, stdout io.Writer) error {
+	name, args := "lftp", []string(nil)
+	if l.wsl {
+		name, args = "wsl.exe", []string{"lftp"}
+	}
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Dir = l.remote.Dir
+	// The script carries the credentials, so it goes in on stdin rather
+	// than argv where any user can read it from the process table. wsl.exe
+	// forwards stdin to lftp unchanged.
+	cmd.Stdin = strings.NewReader(script)
+	if sock := l.remote.agentSocket(); sock != "" {
+		cmd.Env = append(os.Environ(), "SSH_AUTH_SOCK="+sock)
+		if l.wsl {
+			cmd.Env = append(cmd.Env, "WSLENV="+os.Getenv("WSLENV")+":SSH_AUTH_SOCK")
+		}
+	}
+	if runtime.GOOS != "windows" {
+		// Ask lftp to stop first so it writes out its pget status and the
+		// partial file can be resumed with `pget -c`; kill it if it lingers.
+		cmd.Cancel = func() error { return cmd.Process.Signal(syscall.SIGTERM) }
+	}
+	cmd.WaitDelay = 10 * time.Second
+
+	// lftp only ever exits 1, so keep its stderr to tell failures apart.
+	var stderr bytes.Buffer
+	cmd.Stdout = stdout
+	cmd.Stderr = &stderr
+	if l.remote.Verbose {
+		logging.FromContext(ctx).Debug("Executing command", "cmd", cmd.String())
+		cmd.Stderr = io.MultiWriter(os.Stderr, &stderr)
+	}
+
+	if err := cmd.Run(); err != nil {
+		return lftpError(err, stderr.String())
+	}
+	return nil
+}
+
+// permanentLFTP lists lftp messages for failures that retrying won't fix.
+var permanentLFTP = []string{
+	"Login failed",
+	"Login incorrect",
+	"No such file",
+	"Access failed",
+	"Permission denied",
+	"Unknown command",
+}
+
+func lftpError(err error, stderr string) error {
+	msg := strings.TrimSpace(stderr)
+	if i := strings.LastIndexByte(msg, '\n'); i >= 0 {
+		msg = msg[i+1:]
+	}
+	if msg != "" {
+		err = fmt.Errorf("%w: %s", err, msg)
+	}
+	// ssh prints this for both an unknown and a changed host key.
+	if strings.Contains(stderr, "Host key verification failed") {
+		return retry.MarkPermanent(fmt.Errorf("%w: %w", ErrHostKey, err))
+	}
+	for _, marker := range permanentLFTP {
+		if strings.Contains(stderr, marker) {
+			return retry.MarkPermanent(err)
+		}
+	}
+	return retry.MarkTransient(err)
+}
+
+// script is the lftp command file for one download. Credentials are given
+// to `open -u` instead of being embedded in the URL.
+func (l *LFTP) script(job Job) (string, error) {
+	if err := job.Check(); err != nil {
+		return "", err
+	}
+	remotePath, err := l.remote.remotePath(job)
+	if err != nil {
+		return "", err
+	}
+	var s lftpScript
+	l.open(&s)
+	s.command("pget", "-n", strconv.Itoa(l.remote.Segments), "-c", remoteArg(remotePath),
+		"-o", filepath.ToSlash(job.local()))
+	s.command("bye")
+	if s.err != nil {
+		// Only config values get here, and they may be credentials.
+		return "", retry.MarkPermanent(fmt.Errorf("lftp: %w", s.err))
+	}
+	return s.String(), nil
+}
+
+// open writes the settings and login every script starts with.
+func (l *LFTP) open(s *lftpScript) {
+	autoConfirm := "no"
+	if l.remote.hostKeyPolicy() == HostKeyInsecure {
+		autoConfirm = "yes"
+	}
+	s.command("set", "sftp:auto-confirm", autoConfirm)
+	s.command("set", "sftp:connect-program", l.connectProgram())
+	s.command("open", "-u", l.remote.Username+","+l.remote.Password, "sftp://"+l.remote.Host)
+}
+
+// lftpScript writes one lftp command per line with every argument quoted,
+// so nothing in an argument can end the command or start another.
+type lftpScript struct {
+	strings.Builder
+	err error // first argument that could not be quoted
+}
+
+func (s *lftpScript) command(name string, args ...string) {
+	s.WriteString(name)
+	for _, arg := range args {
+		if strings.IndexFunc(arg, unicode.IsControl) >= 0 {
+			s.err = cmp.Or(s.err, fmt.Errorf("%s argument has a control character", name))
+		}
+		s.WriteByte(' ')
+		s.WriteString(quote(arg))
+	}
+	s.WriteByte('\n')
+}
+
+// remoteArg keeps a remote path from being read as an option or a URL: a
+// leading "-" gets "./" in front, and path.Join has already collapsed the
+// "//" of anything that looked like "scheme://".
+func remoteArg(p string) string {
+	if strings.HasPrefix(p, "-") {
+		return "./" + p
+	}
+	return p
+}
+
+// connectProgram is the ssh command lftp runs, with host key checking and
+// the private key applied. lftp hands it to /bin/sh, hence the shell quoting.
+func (l *LFTP) connectProgram() string {
+	args := []string{"ssh", "-a", "-x"}
+	if l.remote.hostKeyPolicy() == HostKeyInsecure {
+		args = append(args, "-o", "StrictHostKeyChecking=no", "-o", "UserKnownHostsFile=/dev/null")
+	} else {
+		args = append(args, "-o", "StrictHostKeyChecking=yes")
+		if l.remote.KnownHosts != "" {
+			args = append(args, "-o", shellQuote("UserKnownHostsFile="+expandHome(l.remote.KnownHosts)))
+		}
+	}
+	if l.remote.PrivateKey != "" {
+		args = append(args, "-i", shellQuote(expandHome(l.remote.PrivateKey)))
+	}
+	return strings.Join(args, " ")
+}
+
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// quote makes s a single lftp argument. Inside double quotes lftp treats
+// ; & | > ! # and whitespace as literals and only a backslash escapes, so
+// escaping backslashes and quotes is enough; control characters are
+// rejected before they get here.
+func quote(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, `"`, `\"`)
+	return `"` + s + `"`
+}
@@ -0,0 +1,139 @@
+package transfer
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// lftpWords splits one script line the way lftp's command parser does and
+// fails on anything that would make it more than a single command: an
+// unquoted ; & | > < or # , a leading !, or an unterminated quote.
+func lftpWords(line string) ([]string, error) {
+	if strings.HasPrefix(strings.TrimLeft(line, " \t"), "!") {
+		return nil, errors.New("shell escape")
+	}
+	var words []string
+	var word strings.Builder
+	inWord, quote := false, byte(0)
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case quote == '\'':
+			if c == '\'' {
+				quote = 0
+			} else {
+				word.WriteByte(c)
+			}
+		case c == '\\':
+			if i+1 == len(line) {
+				return nil, errors.New("trailing backslash")
+			}
+			i++
+			word.WriteByte(line[i])
+			inWord = true
+		case quote == '"':
+			if c == '"' {
+				quote = 0
+			} else {
+				word.WriteByte(c)
+			}
+		case c == '"' || c == '\'':
+			quote, inWord = c, true
+		case c == ' ' || c == '\t':
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+		case strings.IndexByte(";&|><#", c) >= 0:
+			return nil, fmt.Errorf("unquoted %q", c)
+		default:
+			word.WriteByte(c)
+			inWord = true
+		}
+	}
+	if quote != 0 {
+		return nil, errors.New("unterminated quote")
+	}
+	if inWord {
+		words = append(words, word.String())
+	}
+	return words, nil
+}
+
+func testLFTP() *LFTP {
+	return &LFTP{remote: Remote{
+		Host:          "sftp.example.com:22",
+		Username:      "user",
+		Password:      `p"a ss;\`,
+		Segments:      4,
+		PrivateKey:    "/keys/id ed25519",
+		HostKeyPolicy: HostKeyStrict,
+	}}
+}
+
+// FuzzLFTPScript checks that no name or location can add a command to the
+// lftp script or change any argument but the remote path. Hostile names
+// live in testdata/fuzz/FuzzLFTPScript.
+func FuzzLFTPScript(f *testing.F) {
+	f.Add("/remote", "report.pdf")
+	f.Add("/remote/with spaces", "ünïcødé file.mkv")
+	l := testLFTP()
+	f.Fuzz(func(t *testing.T, location, name string) {
+		job := Job{Location: location, Name: name}
+		script, err := l.script(job)
+		if err != nil {
+			if !errors.Is(err, ErrUnsafeName) {
+				t.Fatalf("script(%q, %q): unexpected error %v", location, name, err)
+			}
+			if job.Check() == nil {
+				t.Fatalf("script(%q, %q) rejected a job Check accepts: %v", location, name, err)
+			}
+			return
+		}
+
+		lines := strings.Split(strings.TrimSuffix(script, "\n"), "\n")
+		want := [][]string{
+			{"set", "sftp:auto-confirm", "no"},
+			{"set", "sftp:connect-program", l.connectProgram()},
+			{"open", "-u", `user,p"a ss;\`, "sftp://sftp.example.com:22"},
+			{"pget", "-n", "4", "-c", remoteArg(path.Join(location, name)), "-o", name},
+			{"bye"},
+		}
+		if len(lines) != len(want) {
+			t.Fatalf("script(%q, %q) has %d lines, want %d:\n%s", location, name, len(lines), len(want), script)
+		}
+		for i, line := range lines {
+			words, err := lftpWords(line)
+			if err != nil {
+				t.Fatalf("script(%q, %q) line %d %q: %v", location, name, i+1, line, err)
+			}
+			if !reflect.DeepEqual(words, want[i]) {
+				t.Fatalf("script(%q, %q) line %d = %q, want %q", location, name, i+1, words, want[i])
+			}
+		}
+		if remote := want[3][4]; strings.HasPrefix(remote, "-") || strings.Contains(remote, "://") {
+			t.Fatalf("remote path %q would be read as an option or URL", remote)
+		}
+	})
+}
+
+func TestJobCheck(t *testing.T) {
+	for _, name := range []string{"a\nb", "a\rb", "a\x00b", "\x1b[2Jclear", "a\x7fb", "a\u0085b", "bad\xffutf8"} {
+		if err := (Job{Location: "/in", Name: name}).Check(); !errors.Is(err, ErrUnsafeName) {
+			t.Errorf("Check(name %q) = %v, want ErrUnsafeName", name, err)
+		}
+		if err := (Job{Location: name, Name: "ok.txt"}).Check(); !errors.Is(err, ErrUnsafeName) {
+			t.Errorf("Check(location %q) = %v, want ErrUnsafeName", name, err)
+		}
+	}
+	for _, name := range []string{"plain.txt", "semi;colon", "`tick`", "$(cmd)", "bang!", "ünïcødé", "tab\u00a0nbsp"} {
+		if err := (Job{Location: "/in", Name: name}).Check(); err != nil {
+			t.Errorf("Check(%q) = %v, want nil", name, err)
+		}
+	}
+}
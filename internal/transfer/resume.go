@@ -0,0 +1,81 @@
+package transfer
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/Mwambama/KafkaSync/internal/retry"
+)
+
+// opener starts reading a source from offset. It returns the total size, or
+// -1 if the source does not say, and whether the body really starts at
+// offset; a source that cannot seek starts again from the beginning.
+type opener func(ctx context.Context, offset int64) (body io.ReadCloser, total int64, resumed bool, err error)
+
+// resume streams a single-connection source into localPath, continuing any
+// partial file left there by an earlier attempt the way `pget -c` does. It
+// returns the final size.
+func resume(ctx context.Context, localPath string, open opener) (int64, error) {
+	if err := os.MkdirAll(filepath.Dir(localPath), 0755); err != nil {
+		return 0, err
+	}
+	out, err := os.OpenFile(localPath, os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return 0, err
+	}
+	defer out.Close()
+	info, err := out.Stat()
+	if err != nil {
+		return 0, err
+	}
+
+	offset := info.Size()
+	body, total, resumed, err := open(ctx, offset)
+	if err != nil {
+		return 0, err
+	}
+	if !resumed {
+		offset = 0
+	}
+	if err := out.Truncate(offset); err != nil {
+		body.Close()
+		return 0, err
+	}
+	if _, err := out.Seek(offset, io.SeekStart); err != nil {
+		body.Close()
+		return 0, err
+	}
+
+	n, err := io.Copy(out, body)
+	if cerr := body.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		if ctx.Err() != nil {
+			return 0, ctx.Err()
+		}
+		return 0, err
+	}
+	size := offset + n
+	if total >= 0 && size != total {
+		return 0, retry.MarkTransient(fmt.Errorf("short transfer: %d of %d bytes", size, total))
+	}
+	return size, out.Sync()
+}
+
+// ctxReader stops a read loop over a source that has no cancellation of
+// its own, such as a local file.
+type ctxReader struct {
+	ctx context.Context
+	io.ReadCloser
+}
+
+func (r ctxReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.ReadCloser.Read(p)
+}
@@ -0,0 +1,178 @@
+package transfer
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/Mwambama/KafkaSync/internal/checksum"
+	"github.com/Mwambama/KafkaSync/internal/retry"
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+func init() {
+	Register("s3", newS3, "s3")
+}
+
+// S3 fetches objects from an S3-compatible endpoint (Host), with Username
+// and Password as the access and secret key. Sources are s3://bucket/key;
+// without one, the first segment of Location is the bucket.
+type S3 struct {
+	remote Remote
+	client *minio.Client
+}
+
+func newS3(r Remote) (Transferer, error) {
+	client, err := minio.New(r.Host, &minio.Options{
+		Creds:  credentials.NewStaticV4(r.Username, r.Password, ""),
+		Secure: r.UseSSL,
+		Region: r.Region,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &S3{remote: r, client: client}, nil
+}
+
+func (s *S3) Fetch(ctx context.Context, job Job) (string, int64, error) {
+	if err := job.Check(); err != nil {
+		return "", 0, err
+	}
+	bucket, key, err := s.object(job)
+	if err != nil {
+		return "", 0, err
+	}
+	info, err := s.client.StatObject(ctx, bucket, key, minio.StatObjectOptions{})
+	if err != nil {
+		return "", 0, fmt.Errorf("s3 stat %s/%s: %w", bucket, key, err)
+	}
+	localPath := filepath.Join(s.remote.Dir, job.local())
+
+	size, err := resume(ctx, localPath, func(ctx context.Context, offset int64) (io.ReadCloser, int64, bool, error) {
+		if offset == info.Size && offset > 0 {
+			return io.NopCloser(strings.NewReader("")), info.Size, true, nil
+		}
+		resumed := offset > 0 && offset < info.Size
+		// Pin the ETag so a resumed download cannot splice two versions.
+		opts := minio.GetObjectOptions{}
+		opts.SetMatchETag(info.ETag)
+		if resumed {
+			opts.SetRange(offset, 0)
+		}
+		obj, err := s.client.GetObject(ctx, bucket, key, opts)
+		return obj, info.Size, resumed, err
+	})
+	if err != nil {
+		return "", 0, err
+	}
+	return localPath, size, nil
+}
+
+func (s *S3) Stat(ctx context.Context, job Job) (Entry, error) {
+	if err := job.Check(); err != nil {
+		return Entry{}, err
+	}
+	bucket, key, err := s.object(job)
+	if err != nil {
+		return Entry{}, err
+	}
+	info, err := s.client.StatObject(ctx, bucket, key, minio.StatObjectOptions{})
+	if err != nil {
+		if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+			err = fmt.Errorf("%w: %w", os.ErrNotExist, err)
+		}
+		return Entry{}, fmt.Errorf("s3 stat %s/%s: %w", bucket, key, err)
+	}
+	return Entry{Path: key, Size: info.Size, ModTime: info.LastModified}, nil
+}
+
+// Hash returns a digest the endpoint already stores: the SHA-256 checksum
+// of objects uploaded with one, or the ETag, which is the MD5 of objects
+// uploaded in a single part without KMS encryption.
+func (s *S3) Hash(ctx context.Context, job Job, algos ...string) (string, error) {
+	if err := job.Check(); err != nil {
+		return "", err
+	}
+	bucket, key, err := s.object(job)
+	if err != nil {
+		return "", err
+	}
+	info, err := s.client.StatObject(ctx, bucket, key, minio.StatObjectOptions{Checksum: true})
+	if err != nil {
+		return "", fmt.Errorf("s3 stat %s/%s: %w", bucket, key, err)
+	}
+	for _, algo := range algos {
+		switch algo {
+		case "sha256":
+			raw, err := base64.StdEncoding.DecodeString(info.ChecksumSHA256)
+			if err == nil && len(raw) == sha256.Size && info.ChecksumMode != "COMPOSITE" {
+				return "sha256:" + hex.EncodeToString(raw), nil
+			}
+		case "md5":
+			etag := strings.ToLower(strings.Trim(info.ETag, `"`))
+			if _, err := checksum.Parse("md5:" + etag); err == nil && info.Metadata.Get("X-Amz-Server-Side-Encryption") != "aws:kms" {
+				return "md5:" + etag, nil
+			}
+		}
+	}
+	return "", ErrNoHash
+}
+
+// List returns the objects under the job's key, taken as a prefix.
+func (s *S3) List(ctx context.Context, job Job) ([]Entry, error) {
+	if err := job.Check(); err != nil {
+		return nil, err
+	}
+	bucket, prefix, err := s.location(job)
+	if err != nil {
+		return nil, err
+	}
+	if prefix = strings.TrimSuffix(prefix, "/"); prefix != "" {
+		prefix += "/"
+	}
+	var entries []Entry
+	for obj := range s.client.ListObjects(ctx, bucket, minio.ListObjectsOptions{Prefix: prefix, Recursive: true}) {
+		if obj.Err != nil {
+			return nil, fmt.Errorf("s3 list %s/%s: %w", bucket, prefix, obj.Err)
+		}
+		if rel := strings.TrimPrefix(obj.Key, prefix); rel != "" && !strings.HasSuffix(rel, "/") {
+			entries = append(entries, Entry{Path: rel, Size: obj.Size, ModTime: obj.LastModified})
+		}
+	}
+	return entries, nil
+}
+
+func (s *S3) object(job Job) (bucket, key string, err error) {
+	bucket, key, err = s.location(job)
+	if err == nil && key == "" {
+		err = retry.MarkPermanent(fmt.Errorf("%w: no object key in bucket %q", ErrSource, bucket))
+	}
+	return bucket, key, err
+}
+
+// location splits the job into a bucket and a key, which may be empty.
+func (s *S3) location(job Job) (bucket, key string, err error) {
+	src := job.Source
+	if src != "" {
+		u, err := s.remote.sourceURL(job)
+		if err != nil {
+			return "", "", err
+		}
+		bucket, key = u.Host, strings.TrimPrefix(u.Path, "/")
+	} else {
+		src = path.Join(job.Location, job.Name)
+		bucket, key, _ = strings.Cut(strings.TrimPrefix(src, "/"), "/")
+	}
+	if bucket == "" {
+		return "", "", retry.MarkPermanent(fmt.Errorf("%w: no bucket in %q", ErrSource, src))
+	}
+	return bucket, key, nil
+}
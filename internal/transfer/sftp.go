@@ -0,0 +1,470 @@
+package transfer
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Mwambama/KafkaSync/internal/checksum"
+	"github.com/Mwambama/KafkaSync/internal/retry"
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+)
+
+// statusSuffix names the sidecar file that tracks segment progress,
+// the same idea as lftp's ".lftp-pget-status".
+const statusSuffix = ".kafkasync-pget-status"
+
+// minSegmentSize stops small files from being split into tiny segments.
+const minSegmentSize = 1 << 20
+
+const (
+	chunkSize     = 256 << 10
+	flushInterval = time.Second
+)
+
+func init() {
+	Register("native", NewSFTPClient, "sftp")
+	// "sftp" was the backend name before the registry existed.
+	Register("sftp", NewSFTPClient, "sftp")
+}
+
+// SFTPClient downloads files over SFTP without shelling out to lftp.
+type SFTPClient struct {
+	cfg Remote
+}
+
+func NewSFTPClient(r Remote) (Transferer, error) {
+	if r.Segments < 1 {
+		r.Segments = 1
+	}
+	switch r.hostKeyPolicy() {
+	case HostKeyStrict, HostKeyInsecure:
+	case HostKeyTOFU:
+		if r.HostKeys == nil {
+			return nil, fmt.Errorf("host key policy %s needs a host key store", HostKeyTOFU)
+		}
+	default:
+		return nil, fmt.Errorf("unknown host key policy %q", r.HostKeyPolicy)
+	}
+	return &SFTPClient{cfg: r}, nil
+}
+
+// pgetState is persisted next to the partial file so an interrupted
+// download can pick up where each segment left off.
+type pgetState struct {
+	Size     int64     `json:"size"`
+	ModTime  int64     `json:"mtime"`
+	Segments []segment `json:"segments"`
+}
+
+type segment struct {
+	Next int64 `json:"next"` // next byte to fetch
+	End  int64 `json:"end"`  // exclusive
+}
+
+func (s segment) done() bool { return s.Next >= s.End }
+
+func (c *SFTPClient) dial(ctx context.Context) (*ssh.Client, *sftp.Client, error) {
+	hostKeyCallback, err := hostKeyCallback(ctx, c.cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+	auth, closeAgent, err := authMethods(c.cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+	// The agent is only needed while authenticating.
+	defer closeAgent()
+
+	sshConf := &ssh.ClientConfig{
+		User:            c.cfg.Username,
+		Auth:            auth,
+		HostKeyCallback: hostKeyCallback,
+		Timeout:         30 * time.Second,
+	}
+
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", c.cfg.Host)
+	if err != nil {
+		return nil, nil, err
+	}
+	// Timeout above only covers the TCP dial. The handshake gets the same
+	// bound, and is cut short if ctx ends first.
+	conn.SetDeadline(time.Now().Add(sshConf.Timeout))
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	sshConn, chans, reqs, err := ssh.NewClientConn(conn, c.cfg.Host, sshConf)
+	if !stop() && err == nil {
+		sshConn.Close()
+		err = ctx.Err()
+	}
+	if err == nil {
+		err = conn.SetDeadline(time.Time{})
+	}
+	if err != nil {
+		conn.Close()
+		if ctx.Err() != nil {
+			return nil, nil, ctx.Err()
+		}
+		if strings.Contains(err.Error(), "unable to authenticate") {
+			return nil, nil, retry.MarkPermanent(err)
+		}
+		return nil, nil, err
+	}
+	sshClient := ssh.NewClient(sshConn, chans, reqs)
+
+	client, err := sftp.NewClient(sshClient, sftp.UseConcurrentReads(true))
+	if err != nil {
+		sshClient.Close()
+		return nil, nil, err
+	}
+	return sshClient, client, nil
+}
+
+// Fetch downloads the job into the staging directory using parallel
+// segments, resuming any partial file left behind by a previous attempt.
+func (c *SFTPClient) Fetch(ctx context.Context, job Job) (string, int64, error) {
+	if err := job.Check(); err != nil {
+		return "", 0, err
+	}
+	remotePath, err := c.cfg.remotePath(job)
+	if err != nil {
+		return "", 0, err
+	}
+	sshClient, client, err := c.dial(ctx)
+	if err != nil {
+		return "", 0, fmt.Errorf("sftp connect %s: %w", c.cfg.Host, err)
+	}
+	defer sshClient.Close()
+	defer client.Close()
+
+	// Neither ssh nor sftp take a context, so tear the connection down to
+	// unblock in-flight reads when the caller gives up.
+	stop := context.AfterFunc(ctx, func() { sshClient.Close() })
+	defer stop()
+
+	info, err := client.Stat(remotePath)
+	if err != nil {
+		return "", 0, fmt.Errorf("sftp stat %s: %w", remotePath, err)
+	}
+
+	localPath := filepath.Join(c.cfg.Dir, job.local())
+	statusPath := localPath + statusSuffix
+	if err := os.MkdirAll(filepath.Dir(localPath), 0755); err != nil {
+		return "", 0, err
+	}
+
+	state, err := c.plan(localPath, statusPath, info)
+	if err != nil {
+		return "", 0, err
+	}
+
+	out, err := os.OpenFile(localPath, os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return "", 0, err
+	}
+	defer out.Close()
+
+	if err := c.fetchSegments(ctx, client, remotePath, out, statusPath, state); err != nil {
+		if ctx.Err() != nil {
+			return "", 0, ctx.Err()
+		}
+		return "", 0, err
+	}
+
+	if err := out.Truncate(state.Size); err != nil {
+		return "", 0, err
+	}
+	if err := out.Sync(); err != nil {
+		return "", 0, err
+	}
+	os.Remove(statusPath)
+	return localPath, state.Size, nil
+}
+
+// List walks the job's directory.
+func (c *SFTPClient) List(ctx context.Context, job Job) ([]Entry, error) {
+	if err := job.Check(); err != nil {
+		return nil, err
+	}
+	dir, err := c.cfg.remotePath(job)
+	if err != nil {
+		return nil, err
+	}
+	sshClient, client, err := c.dial(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("sftp connect %s: %w", c.cfg.Host, err)
+	}
+	defer sshClient.Close()
+	defer client.Close()
+	stop := context.AfterFunc(ctx, func() { sshClient.Close() })
+	defer stop()
+
+	var entries []Entry
+	walker := client.Walk(dir)
+	for walker.Step() {
+		if err := walker.Err(); err != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			return nil, fmt.Errorf("sftp list %s: %w", walker.Path(), err)
+		}
+		if !walker.Stat().Mode().IsRegular() {
+			continue
+		}
+		rel, ok := strings.CutPrefix(walker.Path(), strings.TrimSuffix(dir, "/")+"/")
+		if ok {
+			entries = append(entries, Entry{Path: rel, Size: walker.Stat().Size(), ModTime: walker.Stat().ModTime()})
+		}
+	}
+	return entries, nil
+}
+
+func (c *SFTPClient) Stat(ctx context.Context, job Job) (Entry, error) {
+	if err := job.Check(); err != nil {
+		return Entry{}, err
+	}
+	remotePath, err := c.cfg.remotePath(job)
+	if err != nil {
+		return Entry{}, err
+	}
+	sshClient, client, err := c.dial(ctx)
+	if err != nil {
+		return Entry{}, fmt.Errorf("sftp connect %s: %w", c.cfg.Host, err)
+	}
+	defer sshClient.Close()
+	defer client.Close()
+	stop := context.AfterFunc(ctx, func() { sshClient.Close() })
+	defer stop()
+
+	info, err := client.Stat(remotePath)
+	if err != nil {
+		return Entry{}, fmt.Errorf("sftp stat %s: %w", remotePath, err)
+	}
+	return Entry{Path: remotePath, Size: info.Size(), ModTime: info.ModTime()}, nil
+}
+
+// hashCommands are the tools Hash runs on the server, by algorithm.
+var hashCommands = map[string]string{"sha256": "sha256sum", "md5": "md5sum"}
+
+// Hash runs sha256sum or md5sum on the server over the same SSH
+// connection. Servers that only allow the SFTP subsystem refuse the
+// command, which is reported as ErrNoHash.
+func (c *SFTPClient) Hash(ctx context.Context, job Job, algos ...string) (string, error) {
+	if err := job.Check(); err != nil {
+		return "", err
+	}
+	remotePath, err := c.cfg.remotePath(job)
+	if err != nil {
+		return "", err
+	}
+	sshClient, client, err := c.dial(ctx)
+	if err != nil {
+		return "", fmt.Errorf("sftp connect %s: %w", c.cfg.Host, err)
+	}
+	defer sshClient.Close()
+	defer client.Close()
+	stop := context.AfterFunc(ctx, func() { sshClient.Close() })
+	defer stop()
+
+	for _, algo := range algos {
+		command, ok := hashCommands[algo]
+		if !ok {
+			continue
+		}
+		session, err := sshClient.NewSession()
+		if err != nil {
+			return "", err
+		}
+		// Job.Check has refused control characters, so quoting is enough.
+		out, err := session.Output(command + " -- " + shellQuote(remotePath))
+		session.Close()
+		if ctx.Err() != nil {
+			return "", ctx.Err()
+		}
+		if err != nil {
+			continue
+		}
+		// "<hex>  <path>"
+		digest, _, _ := strings.Cut(string(out), " ")
+		if sum, err := checksum.Parse(algo + ":" + digest); err == nil {
+			return sum.String(), nil
+		}
+	}
+	return "", ErrNoHash
+}
+
+// plan works out which byte ranges still need fetching. A status file that
+// still matches the remote file wins. A bare partial file, with no status
+// file, is continued from its current length, as `pget -c` does. A status
+// file that does not match or parse means the partial file came from a
+// segmented fetch of another version: it has holes and stale bytes, so it
+// is thrown away.
+func (c *SFTPClient) plan(localPath, statusPath string, info os.FileInfo) (*pgetState, error) {
+	size, mtime := info.Size(), info.ModTime().Unix()
+
+	var offset int64
+	raw, err := os.ReadFile(statusPath)
+	switch {
+	case err == nil || !errors.Is(err, os.ErrNotExist):
+		var st pgetState
+		if err == nil && json.Unmarshal(raw, &st) == nil && st.Size == size && st.ModTime == mtime {
+			if _, err := os.Stat(localPath); err == nil {
+				return &st, nil
+			}
+		}
+		if err := os.Truncate(localPath, 0); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+	default:
+		if fi, err := os.Stat(localPath); err == nil {
+			offset = fi.Size()
+			if offset > size {
+				// The remote file shrank; nothing local can be trusted.
+				if err := os.Truncate(localPath, 0); err != nil {
+					return nil, err
+				}
+				offset = 0
+			}
+		}
+	}
+
+	st := &pgetState{Size: size, ModTime: mtime, Segments: split(offset, size, c.cfg.Segments)}
+	if err := writeState(statusPath, st); err != nil {
+		return nil, err
+	}
+	return st, nil
+}
+
+// split divides [from, to) into at most n segments of at least minSegmentSize.
+func split(from, to int64, n int) []segment {
+	remaining := to - from
+	if remaining <= 0 {
+		return nil
+	}
+	if limit := int((remaining + minSegmentSize - 1) / minSegmentSize); n > limit {
+		n = limit
+	}
+	step := remaining / int64(n)
+
+	segs := make([]segment, n)
+	for i := range segs {
+		segs[i] = segment{Next: from + int64(i)*step, End: from + int64(i+1)*step}
+	}
+	segs[n-1].End = to
+	return segs
+}
+
+func writeState(statusPath string, st *pgetState) error {
+	raw, err := json.Marshal(st)
+	if err != nil {
+		return err
+	}
+	tmp := statusPath + ".tmp"
+	if err := os.WriteFile(tmp, raw, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, statusPath)
+}
+
+func (c *SFTPClient) fetchSegments(ctx context.Context, client *sftp.Client, remotePath string, out *os.File, statusPath string, st *pgetState) error {
+	var mu sync.Mutex
+	save := func() error {
+		mu.Lock()
+		defer mu.Unlock()
+		return writeState(statusPath, st)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	flushDone := make(chan struct{})
+	go func() {
+		defer close(flushDone)
+		ticker := time.NewTicker(flushInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				save()
+			}
+		}
+	}()
+
+	var wg sync.WaitGroup
+	errs := make(chan error, len(st.Segments))
+	for i := range st.Segments {
+		if st.Segments[i].done() {
+			continue
+		}
+		wg.Add(1)
+		go func(seg *segment) {
+			defer wg.Done()
+			if err := fetchSegment(ctx, client, remotePath, out, seg, &mu); err != nil {
+				errs <- err
+				cancel()
+			}
+		}(&st.Segments[i])
+	}
+	wg.Wait()
+	cancel()
+	<-flushDone
+	close(errs)
+
+	// Always persist progress so a failed attempt can be resumed.
+	if err := save(); err != nil {
+		return err
+	}
+	return <-errs
+}
+
+func fetchSegment(ctx context.Context, client *sftp.Client, remotePath string, out *os.File, seg *segment, mu *sync.Mutex) error {
+	in, err := client.Open(remotePath)
+	if err != nil {
+		return fmt.Errorf("sftp open %s: %w", remotePath, err)
+	}
+	defer in.Close()
+
+	buf := make([]byte, chunkSize)
+	for {
+		mu.Lock()
+		next, end := seg.Next, seg.End
+		mu.Unlock()
+		if next >= end {
+			return nil
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		want := int64(len(buf))
+		if end-next < want {
+			want = end - next
+		}
+		n, err := in.ReadAt(buf[:want], next)
+		if n > 0 {
+			if _, werr := out.WriteAt(buf[:n], next); werr != nil {
+				return werr
+			}
+			mu.Lock()
+			seg.Next += int64(n)
+			mu.Unlock()
+		}
+		if err != nil && !(errors.Is(err, io.EOF) && int64(n) == want) {
+			if errors.Is(err, io.EOF) {
+				return fmt.Errorf("sftp read %s: remote file truncated at %d", remotePath, next+int64(n))
+			}
+			return fmt.Errorf("sftp read %s: %w", remotePath, err)
+		}
+	}
+}
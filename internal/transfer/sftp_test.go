@@ -0,0 +1,232 @@
+package transfer
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/pkg/sftp"
+)
+
+func TestSplit(t *testing.T) {
+	const mb = minSegmentSize
+	cases := []struct {
+		from, to int64
+		n        int
+		want     []segment
+	}{
+		{0, 0, 4, nil},
+		{10, 10, 4, nil},
+		{10, 5, 4, nil},
+		{0, 100, 4, []segment{{0, 100}}}, // too small to split
+		{0, 4 * mb, 4, []segment{{0, mb}, {mb, 2 * mb}, {2 * mb, 3 * mb}, {3 * mb, 4 * mb}}},
+		{0, 2*mb + 1, 8, []segment{{0, (2*mb + 1) / 3}, {(2*mb + 1) / 3, 2 * ((2*mb + 1) / 3)}, {2 * ((2*mb + 1) / 3), 2*mb + 1}}},
+		{mb, 3 * mb, 2, []segment{{mb, 2 * mb}, {2 * mb, 3 * mb}}},
+		{0, 3*mb + 7, 1, []segment{{0, 3*mb + 7}}},
+	}
+	for _, c := range cases {
+		got := split(c.from, c.to, c.n)
+		if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("split(%d, %d, %d) = %v, want %v", c.from, c.to, c.n, got, c.want)
+		}
+		// Whatever the split, the segments cover the range exactly once.
+		next := c.from
+		for _, s := range got {
+			if s.Next != next || s.End <= s.Next {
+				t.Errorf("split(%d, %d, %d): segment %v does not follow on from %d", c.from, c.to, c.n, s, next)
+			}
+			next = s.End
+		}
+		if len(got) > 0 && next != c.to {
+			t.Errorf("split(%d, %d, %d) ends at %d", c.from, c.to, c.n, next)
+		}
+	}
+}
+
+func TestPlan(t *testing.T) {
+	const size = 3*minSegmentSize + 5
+	mtime := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	resumable := &pgetState{Size: size, ModTime: mtime.Unix(), Segments: []segment{{100, minSegmentSize}, {minSegmentSize + 7, size}}}
+	status := func(st *pgetState) string {
+		raw, _ := json.Marshal(st)
+		return string(raw)
+	}
+
+	cases := []struct {
+		name      string
+		status    string // "" for none
+		local     int64  // bytes of partial file, -1 for none
+		wantFrom  int64  // where a fresh plan starts, -1 to keep resumable
+		wantLocal int64  // length of the partial file afterwards, -1 for none
+	}{
+		{"matching status file", status(resumable), 2 * minSegmentSize, -1, 2 * minSegmentSize},
+		{"status for another size", status(&pgetState{Size: size + 1, ModTime: mtime.Unix(), Segments: resumable.Segments}), 2 * minSegmentSize, 0, 0},
+		{"status for another mtime", status(&pgetState{Size: size, ModTime: mtime.Unix() - 60, Segments: resumable.Segments}), 2 * minSegmentSize, 0, 0},
+		{"corrupt status file", `{"size": 3`, 2 * minSegmentSize, 0, 0},
+		{"status without partial file", status(resumable), -1, 0, -1},
+		{"bare partial file", "", minSegmentSize + 3, minSegmentSize + 3, minSegmentSize + 3},
+		{"remote shrank below partial", "", size + 10, 0, 0},
+		{"nothing yet", "", -1, 0, -1},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			dir := t.TempDir()
+			remote := filepath.Join(dir, "remote.bin")
+			if err := os.WriteFile(remote, make([]byte, size), 0644); err != nil {
+				t.Fatal(err)
+			}
+			os.Chtimes(remote, mtime, mtime)
+			info, _ := os.Stat(remote)
+
+			local := filepath.Join(dir, "local.bin")
+			statusPath := local + statusSuffix
+			if c.local >= 0 {
+				os.WriteFile(local, bytes.Repeat([]byte{'x'}, int(c.local)), 0644)
+			}
+			if c.status != "" {
+				os.WriteFile(statusPath, []byte(c.status), 0644)
+			}
+
+			client := &SFTPClient{cfg: Remote{Segments: 4}}
+			st, err := client.plan(local, statusPath, info)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := resumable
+			if c.wantFrom >= 0 {
+				want = &pgetState{Size: size, ModTime: mtime.Unix(), Segments: split(c.wantFrom, size, 4)}
+			}
+			if !reflect.DeepEqual(st, want) {
+				t.Errorf("plan = %+v, want %+v", st, want)
+			}
+			if raw, _ := os.ReadFile(statusPath); string(raw) != status(want) {
+				t.Errorf("status file = %s, want %s", raw, status(want))
+			}
+			fi, err := os.Stat(local)
+			switch {
+			case c.wantLocal < 0 && err == nil:
+				t.Errorf("partial file created (%d bytes)", fi.Size())
+			case c.wantLocal >= 0 && (err != nil || fi.Size() != c.wantLocal):
+				t.Errorf("partial file = %v, %v, want %d bytes", fi, err, c.wantLocal)
+			}
+		})
+	}
+}
+
+// pipeConn joins the halves of two pipes into one connection.
+type pipeConn struct {
+	io.Reader
+	io.WriteCloser
+}
+
+// sftpPipe serves dir over SFTP in memory and returns a client for it.
+func sftpPipe(t *testing.T, dir string) *sftp.Client {
+	t.Helper()
+	clientRead, serverWrite := io.Pipe()
+	serverRead, clientWrite := io.Pipe()
+	server, err := sftp.NewServer(pipeConn{serverRead, serverWrite}, sftp.WithServerWorkingDirectory(dir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	go server.Serve()
+	client, err := sftp.NewClientPipe(clientRead, clientWrite)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		// The server first: closing its end is what ends the client's
+		// read loop.
+		server.Close()
+		client.Close()
+	})
+	return client
+}
+
+// A resumed fetch only fills the bytes its segments still miss, and leaves
+// the status file recording every segment done.
+func TestFetchSegments(t *testing.T) {
+	dir := t.TempDir()
+	data := bytes.Repeat([]byte("0123456789abcdef"), (3*minSegmentSize)/16+3)
+	os.WriteFile(filepath.Join(dir, "remote.bin"), data, 0644)
+
+	size := int64(len(data))
+	st := &pgetState{Size: size, Segments: split(0, size, 3)}
+	// The first segment is done and half of the second; the rest of the
+	// local file is a hole.
+	st.Segments[0].Next = st.Segments[0].End
+	st.Segments[1].Next += (st.Segments[1].End - st.Segments[1].Next) / 2
+	local := filepath.Join(dir, "local.bin")
+	partial := make([]byte, st.Segments[1].Next)
+	copy(partial, data)
+	os.WriteFile(local, partial, 0644)
+	statusPath := local + statusSuffix
+
+	out, err := os.OpenFile(local, os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer out.Close()
+	client := &SFTPClient{}
+	if err := client.fetchSegments(context.Background(), sftpPipe(t, dir), "remote.bin", out, statusPath, st); err != nil {
+		t.Fatalf("fetchSegments: %v", err)
+	}
+
+	if got, _ := os.ReadFile(local); !bytes.Equal(got, data) {
+		t.Errorf("local file differs from the remote (%d bytes, want %d)", len(got), len(data))
+	}
+	var saved pgetState
+	raw, _ := os.ReadFile(statusPath)
+	if err := json.Unmarshal(raw, &saved); err != nil {
+		t.Fatalf("status file: %v", err)
+	}
+	for i, s := range saved.Segments {
+		if !s.done() {
+			t.Errorf("segment %d = %v, want done", i, s)
+		}
+	}
+
+	// A remote that is shorter than planned is an error, not a short file.
+	st = &pgetState{Size: size + 10, Segments: []segment{{0, size + 10}}}
+	if err := client.fetchSegments(context.Background(), sftpPipe(t, dir), "remote.bin", out, statusPath, st); err == nil {
+		t.Error("remote shorter than planned: want an error")
+	}
+}
+
+// A server that accepts the connection and then says nothing must not hold
+// the worker past its context.
+func TestDialStalledHandshake(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+
+	c := &SFTPClient{cfg: Remote{Host: ln.Addr().String(), Username: "u", Password: "p", HostKeyPolicy: HostKeyInsecure}}
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	started := time.Now()
+	_, _, err = c.dial(ctx)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("dial = %v, want the context's error", err)
+	}
+	if waited := time.Since(started); waited > 5*time.Second {
+		t.Errorf("dial returned after %v, want it to stop with the context", waited)
+	}
+}
@@ -0,0 +1,126 @@
+package transfer
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"path"
+	"slices"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/Mwambama/KafkaSync/internal/retry"
+)
+
+// ErrSource is returned for a source URI the remote cannot or must not
+// fetch: another scheme, another server, or credentials in the URI.
+var ErrSource = errors.New("unsupported source")
+
+// defaultPorts fills in the port of a URI or host that leaves it out.
+var defaultPorts = map[string]string{
+	"sftp":  "22",
+	"ftp":   "21",
+	"ftps":  "21",
+	"http":  "80",
+	"https": "443",
+}
+
+// Serves reports whether r can fetch source: its backend handles the scheme
+// and, where the URI names a server, r is that server. The consumer uses it
+// to pick a remote for a message that only carries a source URI.
+func Serves(r Remote, source string) bool {
+	_, err := r.sourceURL(Job{Source: source})
+	return err == nil
+}
+
+// sourceURL is the job's source URI, checked against r. Without one the job
+// is Location and Name on r's own server, in r's own scheme.
+func (r Remote) sourceURL(job Job) (*url.URL, error) {
+	schemes := Schemes(r.Backend)
+	if job.Source == "" {
+		if len(schemes) == 0 {
+			return nil, retry.MarkPermanent(fmt.Errorf("%w: backend %q has no scheme", ErrSource, r.Backend))
+		}
+		p := path.Join(job.Location, job.Name)
+		if !strings.HasPrefix(p, "/") {
+			p = "/" + p
+		}
+		return &url.URL{Scheme: schemes[0], Host: r.Host, Path: p}, nil
+	}
+
+	u, err := url.Parse(job.Source)
+	if err != nil {
+		return nil, retry.MarkPermanent(fmt.Errorf("%w: %w", ErrSource, err))
+	}
+	bad := func(format string, args ...any) (*url.URL, error) {
+		return nil, retry.MarkPermanent(fmt.Errorf("%w: %s: %s", ErrSource, u.Redacted(), fmt.Sprintf(format, args...)))
+	}
+	switch {
+	case !slices.Contains(schemes, u.Scheme):
+		return bad("backend %q fetches %v, not %s", cmp.Or(r.Backend, "lftp"), schemes, u.Scheme)
+	case u.User != nil:
+		return bad("credentials belong in the remote's config, not the URI")
+	case u.Opaque != "" || u.Path == "":
+		return bad("no path")
+	}
+	// Check saw the URI still escaped; %0D%0A only becomes a line break,
+	// and a second FTP command, once decoded.
+	for _, f := range []struct{ what, s string }{{"host", u.Host}, {"path", u.Path}} {
+		if i := strings.IndexFunc(f.s, unicode.IsControl); i >= 0 || !utf8.ValidString(f.s) {
+			return nil, retry.MarkPermanent(fmt.Errorf("%w: source %s %q has a control character or invalid UTF-8", ErrUnsafeName, f.what, f.s))
+		}
+	}
+	switch u.Scheme {
+	case "s3":
+		// The bucket sits where the host would; any bucket on the endpoint
+		// is fair game.
+	case "file":
+		if u.Host != "" && u.Host != "localhost" {
+			return bad("file URIs must be local")
+		}
+	default:
+		if !sameHost(u.Host, r.Host, defaultPorts[u.Scheme]) {
+			return bad("not this remote's host %s", r.Host)
+		}
+	}
+	return u, nil
+}
+
+// remotePath is the path to fetch on r's server: the source URI's path, or
+// Location and Name joined as they always have been.
+func (r Remote) remotePath(job Job) (string, error) {
+	if job.Source == "" {
+		return path.Join(job.Location, job.Name), nil
+	}
+	u, err := r.sourceURL(job)
+	if err != nil {
+		return "", err
+	}
+	return u.Path, nil
+}
+
+// sameHost compares host[:port] pairs case-insensitively, filling in the
+// scheme's default port on either side.
+func sameHost(a, b, port string) bool {
+	split := func(h string) (string, string) {
+		host, p, err := net.SplitHostPort(h)
+		if err != nil {
+			return strings.Trim(h, "[]"), port
+		}
+		return host, p
+	}
+	ah, ap := split(a)
+	bh, bp := split(b)
+	return strings.EqualFold(ah, bh) && ap == bp
+}
+
+// withPort adds the scheme's default port to a host that has none.
+func withPort(host, scheme string) string {
+	if _, _, err := net.SplitHostPort(host); err == nil {
+		return host
+	}
+	return net.JoinHostPort(strings.Trim(host, "[]"), defaultPorts[scheme])
+}
@@ -0,0 +1,288 @@
+package transfer
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Mwambama/KafkaSync/internal/retry"
+)
+
+var payload = bytes.Repeat([]byte("0123456789abcdef"), 4096)
+
+// fetchResumed stages the first third of payload as a partial file, fetches
+// job and checks the result is the whole payload.
+func fetchResumed(t *testing.T, r Remote, job Job) {
+	t.Helper()
+	if err := os.WriteFile(filepath.Join(r.Dir, "out.bin"), payload[:len(payload)/3], 0644); err != nil {
+		t.Fatal(err)
+	}
+	job.LocalName = "out.bin"
+	tr, err := New(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	local, size, err := tr.Fetch(context.Background(), job)
+	if err != nil {
+		t.Fatalf("Fetch: %v", err)
+	}
+	got, _ := os.ReadFile(local)
+	if size != int64(len(payload)) || !bytes.Equal(got, payload) {
+		t.Fatalf("Fetch wrote %d bytes (reported %d), want the %d-byte payload", len(got), size, len(payload))
+	}
+}
+
+func TestHTTPResume(t *testing.T) {
+	var ranges []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if user, pass, _ := req.BasicAuth(); user != "u" || pass != "p" {
+			http.Error(w, "no", http.StatusUnauthorized)
+			return
+		}
+		if req.URL.Path != "/files/data.bin" {
+			http.NotFound(w, req)
+			return
+		}
+		ranges = append(ranges, req.Header.Get("Range"))
+		http.ServeContent(w, req, "data.bin", time.Time{}, bytes.NewReader(payload))
+	}))
+	defer srv.Close()
+	host := strings.TrimPrefix(srv.URL, "http://")
+	r := Remote{Backend: "http", Host: host, Username: "u", Password: "p", Dir: t.TempDir()}
+
+	fetchResumed(t, r, Job{Location: "/files", Name: "data.bin"})
+	if want := fmt.Sprintf("bytes=%d-", len(payload)/3); len(ranges) != 1 || ranges[0] != want {
+		t.Errorf("requests = %q, want one with Range %q", ranges, want)
+	}
+	fetchResumed(t, r, Job{Source: srv.URL + "/files/data.bin"})
+
+	tr, _ := New(r)
+	_, _, err := tr.Fetch(context.Background(), Job{Location: "/files", Name: "missing.bin"})
+	if !errors.Is(err, os.ErrNotExist) || retry.Classify(err) != retry.Permanent {
+		t.Errorf("404: err = %v, want a permanent not-exist error", err)
+	}
+	if e, err := tr.(Stater).Stat(context.Background(), Job{Location: "/files", Name: "data.bin"}); err != nil || e.Size != int64(len(payload)) {
+		t.Errorf("Stat = %+v, %v, want %d bytes", e, err, len(payload))
+	}
+	if _, err := tr.(Stater).Stat(context.Background(), Job{Location: "/files", Name: "data.bin.done"}); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Stat of a missing marker: err = %v, want a not-exist error", err)
+	}
+	_, _, err = tr.Fetch(context.Background(), Job{Source: "https://elsewhere.example.com/files/data.bin"})
+	if !errors.Is(err, ErrSource) {
+		t.Errorf("other scheme: err = %v, want ErrSource", err)
+	}
+	_, _, err = tr.Fetch(context.Background(), Job{Source: "http://elsewhere.example.com/files/data.bin"})
+	if !errors.Is(err, ErrSource) {
+		t.Errorf("other host: err = %v, want ErrSource so credentials stay with their server", err)
+	}
+}
+
+func TestFileRoot(t *testing.T) {
+	root := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(root, "in"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "in", "data.bin"), payload, 0644); err != nil {
+		t.Fatal(err)
+	}
+	outside := filepath.Join(t.TempDir(), "secret")
+	os.WriteFile(outside, []byte("secret"), 0644)
+	os.Symlink(outside, filepath.Join(root, "in", "link"))
+
+	r := Remote{Backend: "file", Root: root, Dir: t.TempDir()}
+	fetchResumed(t, r, Job{Location: "in", Name: "data.bin"})
+	fetchResumed(t, r, Job{Source: (&url.URL{Scheme: "file", Path: filepath.ToSlash(filepath.Join(root, "in", "data.bin"))}).String()})
+
+	tr, _ := New(r)
+	entries, err := tr.(Lister).List(context.Background(), Job{Location: "in"})
+	for i := range entries {
+		if entries[i].ModTime.IsZero() {
+			t.Errorf("List: %s has no modification time", entries[i].Path)
+		}
+		entries[i].ModTime = time.Time{}
+	}
+	if want := []Entry{{Path: "data.bin", Size: int64(len(payload))}}; err != nil || !reflect.DeepEqual(entries, want) {
+		t.Errorf("List = %v, %v, want %v without the symlink", entries, err, want)
+	}
+	sum, err := tr.(Hasher).Hash(context.Background(), Job{Location: "in", Name: "data.bin"}, "blake3", "sha256")
+	if want := fmt.Sprintf("sha256:%x", sha256.Sum256(payload)); err != nil || sum != want {
+		t.Errorf("Hash = %q, %v, want %q", sum, err, want)
+	}
+	for _, job := range []Job{
+		{Location: "in", Name: "link"},
+		{Location: "..", Name: filepath.Base(outside)},
+		{Source: (&url.URL{Scheme: "file", Path: filepath.ToSlash(outside)}).String()},
+	} {
+		if _, _, err := tr.Fetch(context.Background(), job); !errors.Is(err, ErrSource) && !errors.Is(err, os.ErrNotExist) {
+			t.Errorf("Fetch(%+v) = %v, want it refused", job, err)
+		}
+	}
+}
+
+// ftpStandIn serves payload as /pub/data.bin over plain FTP, with just the
+// commands the client uses.
+func ftpStandIn(t *testing.T) string {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go serveFTP(conn)
+		}
+	}()
+	return ln.Addr().String()
+}
+
+func serveFTP(conn net.Conn) {
+	defer conn.Close()
+	in := bufio.NewReader(conn)
+	reply := func(format string, args ...any) { fmt.Fprintf(conn, format+"\r\n", args...) }
+	var data net.Listener
+	var rest int64
+	reply("220 stand-in ready")
+	for {
+		line, err := in.ReadString('\n')
+		if err != nil {
+			return
+		}
+		verb, arg, _ := strings.Cut(strings.TrimRight(line, "\r\n"), " ")
+		switch verb {
+		case "USER":
+			reply("331 password please")
+		case "PASS":
+			if arg != "secret" {
+				reply("530 Login incorrect")
+				continue
+			}
+			reply("230 logged in")
+		case "TYPE":
+			reply("200 binary")
+		case "SIZE":
+			if arg != "/pub/data.bin" {
+				reply("550 No such file")
+				continue
+			}
+			reply("213 %d", len(payload))
+		case "MDTM":
+			reply("213 20250301123000")
+		case "EPSV":
+			data, _ = net.Listen("tcp", "127.0.0.1:0")
+			reply("229 Entering Extended Passive Mode (|||%d|)", data.Addr().(*net.TCPAddr).Port)
+		case "REST":
+			rest, _ = strconv.ParseInt(arg, 10, 64)
+			reply("350 restarting at %d", rest)
+		case "MLSD":
+			listing := map[string]string{
+				"/pub":     "type=cdir; .\r\ntype=file;size=%d; data.bin\r\ntype=dir; sub\r\n",
+				"/pub/sub": "type=file;size=%d;modify=20250301123000.5; data.bin\r\ntype=OS.unix=slink; link\r\n",
+			}[arg]
+			reply("150 listing")
+			d, err := data.Accept()
+			data.Close()
+			if err != nil {
+				return
+			}
+			fmt.Fprintf(d, listing, len(payload))
+			d.Close()
+			reply("226 done")
+		case "RETR":
+			reply("150 opening data connection")
+			d, err := data.Accept()
+			data.Close()
+			if err != nil {
+				return
+			}
+			d.Write(payload[rest:])
+			d.Close()
+			reply("226 transfer complete")
+		case "QUIT":
+			reply("221 bye")
+			return
+		default:
+			reply("502 not implemented")
+		}
+	}
+}
+
+func TestFTPResume(t *testing.T) {
+	addr := ftpStandIn(t)
+	r := Remote{Backend: "ftp", Host: addr, Username: "u", Password: "secret", Dir: t.TempDir()}
+	fetchResumed(t, r, Job{Location: "/pub", Name: "data.bin"})
+	fetchResumed(t, r, Job{Source: "ftp://" + addr + "/pub/data.bin"})
+
+	tr, _ := New(r)
+	_, _, err := tr.Fetch(context.Background(), Job{Source: "ftp://" + addr + "/a%0D%0ADELE%20x/f.bin"})
+	if !errors.Is(err, ErrUnsafeName) || retry.Classify(err) != retry.Permanent {
+		t.Errorf("CRLF in the decoded path: err = %v, want a permanent ErrUnsafeName", err)
+	}
+	_, _, err = tr.Fetch(context.Background(), Job{Location: "/pub", Name: "missing.bin"})
+	if !errors.Is(err, os.ErrNotExist) || retry.Classify(err) != retry.Permanent {
+		t.Errorf("missing file: err = %v, want a permanent not-exist error", err)
+	}
+
+	e, err := tr.(Stater).Stat(context.Background(), Job{Location: "/pub", Name: "data.bin"})
+	if want := time.Date(2025, 3, 1, 12, 30, 0, 0, time.UTC); err != nil || e.Size != int64(len(payload)) || !e.ModTime.Equal(want) {
+		t.Errorf("Stat = %+v, %v, want %d bytes modified %v", e, err, len(payload), want)
+	}
+	if _, err := tr.(Stater).Stat(context.Background(), Job{Location: "/pub", Name: "data.bin.done"}); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Stat of a missing marker: err = %v, want a not-exist error", err)
+	}
+
+	entries, err := tr.(Lister).List(context.Background(), Job{Location: "/pub"})
+	want := []Entry{{Path: "data.bin", Size: int64(len(payload))}, {Path: "sub/data.bin", Size: int64(len(payload)), ModTime: time.Date(2025, 3, 1, 12, 30, 0, 0, time.UTC)}}
+	if err != nil || !reflect.DeepEqual(entries, want) {
+		t.Errorf("List = %v, %v, want %v", entries, err, want)
+	}
+
+	r.Password = "wrong"
+	tr, _ = New(r)
+	if _, _, err := tr.Fetch(context.Background(), Job{Location: "/pub", Name: "data.bin"}); retry.Classify(err) != retry.Permanent {
+		t.Errorf("bad login: err = %v, want permanent", err)
+	}
+}
+
+func TestServes(t *testing.T) {
+	cases := []struct {
+		r      Remote
+		source string
+		want   bool
+	}{
+		{Remote{Backend: "native", Host: "sftp.example.com:22"}, "sftp://sftp.example.com/out/a.csv", true},
+		{Remote{Backend: "lftp", Host: "sftp.example.com"}, "sftp://SFTP.example.com:22/out/a.csv", true},
+		{Remote{Backend: "native", Host: "sftp.example.com:2222"}, "sftp://sftp.example.com/out/a.csv", false},
+		{Remote{Backend: "https", Host: "cdn.example.com"}, "https://cdn.example.com:443/a.zip", true},
+		{Remote{Backend: "https", Host: "cdn.example.com"}, "http://cdn.example.com/a.zip", false},
+		{Remote{Backend: "https", Host: "cdn.example.com"}, "https://user:pw@cdn.example.com/a.zip", false},
+		{Remote{Backend: "ftps", Host: "ftp.example.com"}, "ftps://ftp.example.com/a.zip", true},
+		{Remote{Backend: "s3", Host: "minio:9000"}, "s3://any-bucket/key/a.zip", true},
+		{Remote{Backend: "file", Root: "/srv"}, "file:///srv/a.zip", true},
+		{Remote{Backend: "file", Root: "/srv"}, "file://fileserver/srv/a.zip", false},
+		{Remote{Backend: "ftp", Host: "ftp.example.com"}, "ftp://ftp.example.com/a%0D%0ADELE%20x/f.bin", false},
+		{Remote{Backend: "https", Host: "cdn.example.com"}, "https://cdn.example.com/a%00.zip", false},
+	}
+	for _, c := range cases {
+		if got := Serves(c.r, c.source); got != c.want {
+			t.Errorf("Serves(%s %s, %s) = %v, want %v", c.r.Backend, c.r.Host, c.source, got, c.want)
+		}
+	}
+}
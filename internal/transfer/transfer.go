@@ -0,0 +1,213 @@
+// Package transfer fetches remote files into the local staging area.
+package transfer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/Mwambama/KafkaSync/internal/retry"
+)
+
+// ErrMissing is returned when a backend reports success but the file never
+// showed up in the staging directory.
+var ErrMissing = errors.New("file not found after download")
+
+// ErrUnsafeName is returned, before anything is run, for a job whose name or
+// location could not be passed on safely.
+var ErrUnsafeName = errors.New("unsafe file name")
+
+// Job describes a single file to fetch from a remote.
+type Job struct {
+	Location  string // remote directory
+	Name      string // file name inside Location
+	LocalName string // slash-separated path under the staging directory, default Name
+	Source    string // full source URI; when set it replaces Location and Name
+}
+
+// local is where the job is staged, relative to the staging directory.
+func (j Job) local() string {
+	if j.LocalName != "" {
+		return filepath.FromSlash(j.LocalName)
+	}
+	return filepath.FromSlash(j.Name)
+}
+
+// Check rejects names and locations containing control characters or
+// invalid UTF-8. A newline or escape sequence in a name has no legitimate
+// use, and would end a command in the lftp script it is written into.
+func (j Job) Check() error {
+	for _, f := range []struct{ what, s string }{{"location", j.Location}, {"name", j.Name}, {"local name", j.LocalName}, {"source", j.Source}} {
+		if !utf8.ValidString(f.s) {
+			return retry.MarkPermanent(fmt.Errorf("%w: %s %q is not valid UTF-8", ErrUnsafeName, f.what, f.s))
+		}
+		if i := strings.IndexFunc(f.s, unicode.IsControl); i >= 0 {
+			return retry.MarkPermanent(fmt.Errorf("%w: %s %q has a control character at byte %d", ErrUnsafeName, f.what, f.s, i))
+		}
+	}
+	return nil
+}
+
+// Transferer fetches a job into the staging directory and returns the local
+// path and the number of bytes on disk.
+type Transferer interface {
+	Fetch(ctx context.Context, job Job) (string, int64, error)
+}
+
+// Entry is a file found by a Lister or looked at by a Stater.
+type Entry struct {
+	Path    string    // listings: relative to the listed directory, slash-separated
+	Size    int64     // -1 when the backend cannot tell
+	ModTime time.Time // zero when the backend cannot tell
+}
+
+// Lister is implemented by backends that can walk a remote directory for
+// mirror jobs and the watcher. The directory is the job's Source, or
+// Location and Name. Only regular files are returned; symlinks are not
+// followed.
+type Lister interface {
+	List(ctx context.Context, job Job) ([]Entry, error)
+}
+
+// Stater is implemented by backends that can look at a remote file without
+// fetching it, for the readiness checks. A missing file is reported as an
+// error wrapping os.ErrNotExist.
+type Stater interface {
+	Stat(ctx context.Context, job Job) (Entry, error)
+}
+
+// ErrNoHash is returned by a Hasher that cannot compute any of the
+// algorithms asked for.
+var ErrNoHash = errors.New("remote cannot hash this file")
+
+// Hasher is implemented by backends that can hash a remote file without
+// downloading it. Hash returns "algo:hex" for the first of algos the remote
+// can compute, or ErrNoHash.
+type Hasher interface {
+	Hash(ctx context.Context, job Job, algos ...string) (string, error)
+}
+
+// CheckGlobs reports the first malformed pattern.
+func CheckGlobs(patterns ...string) error {
+	for _, pattern := range patterns {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("glob %q: %w", pattern, err)
+		}
+	}
+	return nil
+}
+
+// Selected applies include and exclude globs to a listed path. A pattern
+// without a slash matches the file name, one with a slash the whole path.
+// Exclude wins, and an empty include list takes everything.
+func Selected(rel string, include, exclude []string) bool {
+	match := func(patterns []string) bool {
+		for _, pattern := range patterns {
+			name := rel
+			if !strings.Contains(pattern, "/") {
+				name = path.Base(rel)
+			}
+			if ok, _ := path.Match(pattern, name); ok {
+				return true
+			}
+		}
+		return false
+	}
+	if match(exclude) {
+		return false
+	}
+	return len(include) == 0 || match(include)
+}
+
+// Remote is everything a backend needs to talk to one remote server.
+type Remote struct {
+	Backend  string
+	Host     string
+	Username string
+	Password string
+	Segments int    // parallel connections per file, like `pget -n`
+	Dir      string // staging directory (incompletes)
+	Verbose  bool   // echo commands and stream subprocess output
+
+	Root   string // file: the directory file:// sources must be under
+	UseSSL bool   // s3: HTTPS to the endpoint in Host
+	Region string // s3: bucket region, empty to look it up
+
+	PrivateKey    string       // path to a private key file
+	Passphrase    string       // for an encrypted PrivateKey
+	AgentSocket   string       // ssh-agent socket, e.g. "$SSH_AUTH_SOCK"
+	KnownHosts    string       // known_hosts for HostKeyStrict, default ~/.ssh/known_hosts
+	HostKey       string       // pinned SHA256 fingerprint, checked under any policy but insecure
+	HostKeyPolicy string       // HostKeyStrict (default), HostKeyTOFU or HostKeyInsecure
+	HostKeys      HostKeyStore // fingerprints for HostKeyTOFU
+}
+
+// Factory builds a Transferer for a remote.
+type Factory func(Remote) (Transferer, error)
+
+type backend struct {
+	factory Factory
+	schemes []string // source URI schemes it fetches, the first is its own
+}
+
+var (
+	mu       sync.RWMutex
+	registry = map[string]backend{}
+)
+
+// Register makes a backend available under name, fetching source URIs with
+// the given schemes. It panics on duplicates, so it is meant to be called
+// from init.
+func Register(name string, factory Factory, schemes ...string) {
+	mu.Lock()
+	defer mu.Unlock()
+	if _, dup := registry[name]; dup {
+		panic("transfer: Register called twice for backend " + name)
+	}
+	registry[name] = backend{factory: factory, schemes: schemes}
+}
+
+// Schemes lists the source URI schemes the named backend fetches.
+func Schemes(name string) []string {
+	if name == "" {
+		name = "lftp"
+	}
+	mu.RLock()
+	defer mu.RUnlock()
+	return registry[name].schemes
+}
+
+// Backends lists the registered backend names.
+func Backends() []string {
+	mu.RLock()
+	defer mu.RUnlock()
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// New builds the backend named by r.Backend, defaulting to "lftp".
+func New(r Remote) (Transferer, error) {
+	name := r.Backend
+	if name == "" {
+		name = "lftp"
+	}
+	mu.RLock()
+	b, ok := registry[name]
+	mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown transfer backend %q (available: %v)", name, Backends())
+	}
+	return b.factory(r)
+}